@@ -0,0 +1,666 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"refes/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the admin api speaks plain json over its own listener, regions are given by table suffix
+
+var errBadRequest = errors.New("bad request")
+
+type adminGameC struct {
+	Region  string `json:"region"`
+	Sid     int    `json:"sid"`
+	Title   string `json:"title"`
+	Comment string `json:"comment"`
+	Genre   string `json:"genre"`
+	Lang    string `json:"lang"`
+	Famer   bool   `json:"famer"`
+}
+
+type adminUserC struct {
+	Suid   int    `json:"suid"`
+	Uname  string `json:"uname"`
+	Banned bool   `json:"banned"`
+}
+
+type adminContestC struct {
+	Region string `json:"region"`
+	Contest
+}
+
+type adminStatsS struct {
+	Online int `json:"online"`
+	Daily  int `json:"daily"`
+}
+
+func startAdmin() error {
+	if conf.Admin.Token == "" {
+		return errors.New("admin api enabled without a token")
+	}
+
+	listener, err := listen(conf.Admin.Listen, 0700)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("INFO: admin api starting on %s\n", conf.Admin.Address)
+
+	go func() {
+		err := http.Serve(listener, adminMux())
+		if err != nil {
+			log.Printf("ERROR: admin api stopped: %s\n", err)
+		}
+	}()
+
+	return nil
+}
+
+func adminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/admin/games", adminHandler(http.MethodGet, handleAdminGames))
+	mux.HandleFunc("/admin/games/hide", adminHandler(http.MethodPost, handleAdminGameHide))
+	mux.HandleFunc("/admin/games/restore", adminHandler(http.MethodPost, handleAdminGameRestore))
+	mux.HandleFunc("/admin/games/delete", adminHandler(http.MethodPost, handleAdminGameDelete))
+	mux.HandleFunc("/admin/games/edit", adminHandler(http.MethodPost, handleAdminGameEdit))
+	mux.HandleFunc("/admin/games/famer", adminHandler(http.MethodPost, handleAdminGameFamer))
+	mux.HandleFunc("/admin/reports", adminHandler(http.MethodGet, handleAdminReports))
+	mux.HandleFunc("/admin/reports/resolve", adminHandler(http.MethodPost, handleAdminReportResolve))
+	mux.HandleFunc("/admin/users", adminHandler(http.MethodGet, handleAdminUser))
+	mux.HandleFunc("/admin/users/ban", adminHandler(http.MethodPost, handleAdminUserBan))
+	mux.HandleFunc("/admin/users/rename", adminHandler(http.MethodPost, handleAdminUserRename))
+	mux.HandleFunc("/admin/contests", adminHandler(http.MethodGet, handleAdminContests))
+	mux.HandleFunc("/admin/contests/add", adminHandler(http.MethodPost, handleAdminContestAdd))
+	mux.HandleFunc("/admin/contests/edit", adminHandler(http.MethodPost, handleAdminContestEdit))
+	mux.HandleFunc("/admin/contests/delete", adminHandler(http.MethodPost, handleAdminContestDelete))
+	mux.HandleFunc("/admin/news", adminHandler(http.MethodGet, handleAdminNews))
+	mux.HandleFunc("/admin/news/add", adminHandler(http.MethodPost, handleAdminNewsAdd))
+	mux.HandleFunc("/admin/news/delete", adminHandler(http.MethodPost, handleAdminNewsDelete))
+	mux.HandleFunc("/admin/stats", adminHandler(http.MethodGet, handleAdminStats))
+
+	mux.HandleFunc("/", handleDashboard)
+	mux.HandleFunc("/dashboard/action", handleDashboardAction)
+
+	return mux
+}
+
+// accepts the token as a bearer token or as the password for basic auth
+func adminAuthorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, token, ok = r.BasicAuth()
+	}
+
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(conf.Admin.Token)) == 1
+}
+
+// asks for basic auth so browsers prompt for the token
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !adminAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="reFES admin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// checks auth and method, then writes whatever the handler returns as json
+func adminHandler(method string, handler func(r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+
+		if r.Method != method {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// forms can't send json, so a cross site page can't use a browser's saved credentials here
+		if r.Method == http.MethodPost {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+
+		response, err := handler(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, ErrNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, errBadRequest):
+				status = http.StatusBadRequest
+			default:
+				log.Printf("ERROR: admin handler for %s returned error: %s\n", r.URL.Path, err)
+			}
+
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		if response == nil {
+			response = map[string]bool{"ok": true}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func decodeAdminRequest(r *http.Request, v any) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errBadRequest, err)
+	}
+
+	return nil
+}
+
+func adminRegion(tables string) (*config.Region, error) {
+	region, ok := regionsByTables[tables]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown region %q", errBadRequest, tables)
+	}
+
+	return region, nil
+}
+
+// missing parameters are treated as the fallback
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid %s", errBadRequest, name)
+	}
+
+	return parsed, nil
+}
+
+// region, filter, keyword, sort, direction, contest, award, famer, count, offset
+func handleAdminGames(r *http.Request) (any, error) {
+	region, err := adminRegion(r.URL.Query().Get("region"))
+	if err != nil {
+		return nil, err
+	}
+
+	query := GameQuery{
+		Filter:    r.URL.Query().Get("filter"),
+		Keyword:   r.URL.Query().Get("keyword"),
+		Sort:      r.URL.Query().Get("sort"),
+		Direction: strings.ToUpper(r.URL.Query().Get("direction")),
+	}
+
+	for _, param := range []struct {
+		name     string
+		value    *int
+		fallback int
+	}{
+		{"contest", &query.Contest, 0},
+		{"award", &query.Award, -1},
+		{"famer", &query.Famer, 0},
+		{"count", &query.Count, 100},
+		{"offset", &query.Offset, 0},
+	} {
+		*param.value, err = queryInt(r, param.name, param.fallback)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return adminGames(region, query)
+}
+
+// hidden games are included
+func adminGames(region *config.Region, query GameQuery) ([]Game, error) {
+	query.Hidden = true
+
+	// these end up in the query as is
+	switch query.Filter {
+	case "", "title", "uname", "suid", "password":
+	default:
+		return nil, fmt.Errorf("%w: invalid filter", errBadRequest)
+	}
+
+	switch query.Sort {
+	case "", "updt", "dlcount", "reviewave":
+	default:
+		return nil, fmt.Errorf("%w: invalid sort", errBadRequest)
+	}
+
+	switch query.Direction {
+	case "":
+		query.Direction = "ASC"
+	case "ASC", "DESC":
+	default:
+		return nil, fmt.Errorf("%w: invalid direction", errBadRequest)
+	}
+
+	return store.Games(region.Tables, query)
+}
+
+func setAdminGameHidden(r *http.Request, hidden bool) (any, error) {
+	adminGameC := &adminGameC{}
+	err := decodeAdminRequest(r, adminGameC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := adminRegion(adminGameC.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, adminSetHidden(region, adminGameC.Sid, hidden)
+}
+
+// moderation actions shared by the api and the dashboard
+
+func adminSetHidden(region *config.Region, sid int, hidden bool) error {
+	err := store.SetHidden(region.Tables, sid, hidden)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("INFO: admin set game %d/%s hidden: %t\n", sid, region.Tables, hidden)
+
+	return nil
+}
+
+func adminResolveReports(region *config.Region, sid int) error {
+	err := store.ResolveReports(region.Tables, sid)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("INFO: admin resolved reports for game %d/%s\n", sid, region.Tables)
+
+	return nil
+}
+
+func adminSetBanned(suid int, banned bool) error {
+	err := store.SetBanned(suid, banned)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("INFO: admin set user %d banned: %t\n", suid, banned)
+
+	return nil
+}
+
+func handleAdminGameHide(r *http.Request) (any, error) {
+	return setAdminGameHidden(r, true)
+}
+
+func handleAdminGameRestore(r *http.Request) (any, error) {
+	return setAdminGameHidden(r, false)
+}
+
+func handleAdminGameDelete(r *http.Request) (any, error) {
+	adminGameC := &adminGameC{}
+	err := decodeAdminRequest(r, adminGameC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := adminRegion(adminGameC.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	game, err := store.Game(region.Tables, adminGameC.Sid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = removeGame(region, game)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: admin deleted game %d/%s\n", adminGameC.Sid, region.Tables)
+
+	return nil, nil
+}
+
+// empty fields are left as they are
+func handleAdminGameEdit(r *http.Request) (any, error) {
+	adminGameC := &adminGameC{}
+	err := decodeAdminRequest(r, adminGameC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := adminRegion(adminGameC.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	game, err := store.Game(region.Tables, adminGameC.Sid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range []struct {
+		value *string
+		edit  string
+	}{
+		{&game.Title, adminGameC.Title},
+		{&game.Comment, adminGameC.Comment},
+		{&game.Genre, adminGameC.Genre},
+		{&game.Lang, adminGameC.Lang},
+	} {
+		if field.edit != "" {
+			*field.value = field.edit
+		}
+	}
+
+	err = store.EditGame(region.Tables, game)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: admin edited game %d/%s\n", adminGameC.Sid, region.Tables)
+
+	return game, nil
+}
+
+func handleAdminGameFamer(r *http.Request) (any, error) {
+	adminGameC := &adminGameC{}
+	err := decodeAdminRequest(r, adminGameC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := adminRegion(adminGameC.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.SetFamer(region.Tables, adminGameC.Sid, adminGameC.Famer, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: admin set game %d/%s famer: %t\n", adminGameC.Sid, region.Tables, adminGameC.Famer)
+
+	return nil, nil
+}
+
+func handleAdminReports(r *http.Request) (any, error) {
+	region, err := adminRegion(r.URL.Query().Get("region"))
+	if err != nil {
+		return nil, err
+	}
+
+	reports, err := store.Reports(region.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+func handleAdminReportResolve(r *http.Request) (any, error) {
+	adminGameC := &adminGameC{}
+	err := decodeAdminRequest(r, adminGameC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := adminRegion(adminGameC.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, adminResolveReports(region, adminGameC.Sid)
+}
+
+func handleAdminUser(r *http.Request) (any, error) {
+	suid, err := queryInt(r, "suid", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := store.UserBySuid(suid)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func handleAdminUserBan(r *http.Request) (any, error) {
+	adminUserC := &adminUserC{}
+	err := decodeAdminRequest(r, adminUserC)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, adminSetBanned(adminUserC.Suid, adminUserC.Banned)
+}
+
+// the ng word list doesn't apply to admins but everything else does
+func handleAdminUserRename(r *http.Request) (any, error) {
+	adminUserC := &adminUserC{}
+	err := decodeAdminRequest(r, adminUserC)
+	if err != nil {
+		return nil, err
+	}
+
+	endCode := validateUname(adminUserC.Uname)
+	if endCode != EndCodeSuccess && endCode != EndCodeUnameNg {
+		return nil, fmt.Errorf("%w: invalid user name", errBadRequest)
+	}
+
+	_, err = store.UserBySuid(adminUserC.Suid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.SetUname(adminUserC.Suid, adminUserC.Uname)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: admin renamed user %d\n", adminUserC.Suid)
+
+	return nil, nil
+}
+
+func handleAdminContests(r *http.Request) (any, error) {
+	region, err := adminRegion(r.URL.Query().Get("region"))
+	if err != nil {
+		return nil, err
+	}
+
+	contests, err := store.Contests(region.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	return contests, nil
+}
+
+func decodeAdminContest(r *http.Request) (*config.Region, Contest, error) {
+	adminContestC := &adminContestC{}
+	err := decodeAdminRequest(r, adminContestC)
+	if err != nil {
+		return nil, Contest{}, err
+	}
+
+	region, err := adminRegion(adminContestC.Region)
+	if err != nil {
+		return nil, Contest{}, err
+	}
+
+	return region, adminContestC.Contest, nil
+}
+
+func handleAdminContestAdd(r *http.Request) (any, error) {
+	region, contest, err := decodeAdminContest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	contest.Id, err = store.AddContest(region.Tables, contest)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: admin added contest %d/%s\n", contest.Id, region.Tables)
+
+	return contest, nil
+}
+
+func handleAdminContestEdit(r *http.Request) (any, error) {
+	region, contest, err := decodeAdminContest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.EditContest(region.Tables, contest)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: admin edited contest %d/%s\n", contest.Id, region.Tables)
+
+	return contest, nil
+}
+
+func handleAdminContestDelete(r *http.Request) (any, error) {
+	region, contest, err := decodeAdminContest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.DeleteContest(region.Tables, contest.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: admin deleted contest %d/%s\n", contest.Id, region.Tables)
+
+	return nil, nil
+}
+
+func handleAdminNews(r *http.Request) (any, error) {
+	news, err := store.NewsList()
+	if err != nil {
+		return nil, err
+	}
+
+	return news, nil
+}
+
+// body is base64 in json
+func handleAdminNewsAdd(r *http.Request) (any, error) {
+	news := News{}
+	err := decodeAdminRequest(r, &news)
+	if err != nil {
+		return nil, err
+	}
+
+	if news.Region != "" {
+		_, err = adminRegion(news.Region)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if news.Publish.IsZero() {
+		news.Publish = time.Now()
+	}
+
+	news.Id, err = store.AddNews(news)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: admin added news post %d\n", news.Id)
+
+	return news, nil
+}
+
+func handleAdminNewsDelete(r *http.Request) (any, error) {
+	news := News{}
+	err := decodeAdminRequest(r, &news)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.DeleteNews(news.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: admin deleted news post %d\n", news.Id)
+
+	return nil, nil
+}
+
+func handleAdminStats(r *http.Request) (any, error) {
+	stats, err := activeUserStats()
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func activeUserStats() (adminStatsS, error) {
+	now := time.Now()
+
+	online, err := store.ActiveUserCount(now.Add(-onlineWindow))
+	if err != nil {
+		return adminStatsS{}, err
+	}
+
+	daily, err := store.ActiveUserCount(now.Add(-24 * time.Hour))
+	if err != nil {
+		return adminStatsS{}, err
+	}
+
+	return adminStatsS{
+		Online: online,
+		Daily:  daily,
+	}, nil
+}
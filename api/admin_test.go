@@ -0,0 +1,213 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func adminRequest(method, target, contentType, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.SetBasicAuth("admin", testAdminToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return req
+}
+
+func addTestGame(t *testing.T) int {
+	t.Helper()
+
+	sid, err := store.AddGame("jp", Game{Title: "test", Updt: time.Now(), Award: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sid
+}
+
+func TestAdminAuth(t *testing.T) {
+	setupTest(t)
+
+	for _, auth := range []string{"", "Bearer wrong", "Basic " + "YWRtaW46d3Jvbmc="} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		rec := httptest.NewRecorder()
+		adminMux().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("authorization %q: got status %d, want %d", auth, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	rec := httptest.NewRecorder()
+	adminMux().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("bearer token: got status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+// a cross site form can send text/plain that happens to be valid json, but never application/json
+func TestAdminRequiresJSON(t *testing.T) {
+	setupTest(t)
+
+	sid := addTestGame(t)
+	body := `{"region":"jp","sid":` + strconv.Itoa(sid) + `,"x":"="}`
+
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{"", http.StatusUnsupportedMediaType},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"multipart/form-data; boundary=x", http.StatusUnsupportedMediaType},
+		{"application/json; charset=utf-8", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		adminMux().ServeHTTP(rec, adminRequest(http.MethodPost, "/admin/games/hide", test.contentType, body))
+
+		if rec.Code != test.want {
+			t.Errorf("content type %q: got status %d, want %d", test.contentType, rec.Code, test.want)
+		}
+	}
+
+	game, err := store.Game("jp", sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !game.Hidden {
+		t.Error("game wasn't hidden by the json request")
+	}
+}
+
+func TestDashboardActionOrigin(t *testing.T) {
+	setupTest(t)
+
+	sid := addTestGame(t)
+
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+		{"http://evil.example", http.StatusForbidden},
+		{"http://example.com.evil.example", http.StatusForbidden},
+		{"http://example.com", http.StatusSeeOther}, // httptest requests are for example.com
+	}
+
+	for _, test := range tests {
+		req := adminRequest(http.MethodPost, "/dashboard/action", "application/x-www-form-urlencoded", "region=jp&action=hide&id="+strconv.Itoa(sid))
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+
+		rec := httptest.NewRecorder()
+		adminMux().ServeHTTP(rec, req)
+
+		if rec.Code != test.want {
+			t.Errorf("origin %q: got status %d, want %d", test.origin, rec.Code, test.want)
+		}
+	}
+}
+
+// each dashboard button has to leave the store the same way its admin api endpoint does
+func TestDashboardMatchesAdminAPI(t *testing.T) {
+	setupTest(t)
+
+	user, err := store.User("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sid := addTestGame(t)
+
+	err = store.AddReport("jp", Report{Sid: sid, Suid: user.Suid, Updt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	game := `{"region":"jp","sid":` + strconv.Itoa(sid) + `}`
+	suid := strconv.Itoa(user.Suid)
+
+	tests := []struct {
+		action, id      string
+		endpoint, body  string
+		hidden, banned  bool
+		reportsResolved bool
+	}{
+		{"hide", strconv.Itoa(sid), "/admin/games/hide", game, true, false, false},
+		{"restore", strconv.Itoa(sid), "/admin/games/restore", game, false, false, false},
+		{"ban", suid, "/admin/users/ban", `{"suid":` + suid + `,"banned":true}`, false, true, false},
+		{"unban", suid, "/admin/users/ban", `{"suid":` + suid + `,"banned":false}`, false, false, false},
+		{"resolve", strconv.Itoa(sid), "/admin/reports/resolve", game, false, false, true},
+	}
+
+	for _, test := range tests {
+		for _, req := range []*http.Request{
+			adminRequest(http.MethodPost, "/dashboard/action", "application/x-www-form-urlencoded", "region=jp&action="+test.action+"&id="+test.id),
+			adminRequest(http.MethodPost, test.endpoint, "application/json", test.body),
+		} {
+			req.Header.Set("Origin", "http://example.com")
+
+			rec := httptest.NewRecorder()
+			adminMux().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusSeeOther && rec.Code != http.StatusOK {
+				t.Fatalf("%s %s: got status %d", test.action, req.URL.Path, rec.Code)
+			}
+
+			game, err := store.Game("jp", sid)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := store.UserBySuid(user.Suid)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reports, err := store.Reports("jp")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if game.Hidden != test.hidden || user.Banned != test.banned || (len(reports) == 0) != test.reportsResolved {
+				t.Errorf("%s %s: got hidden %t, banned %t, %d reports", test.action, req.URL.Path, game.Hidden, user.Banned, len(reports))
+			}
+		}
+	}
+}
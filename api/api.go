@@ -19,7 +19,6 @@
 package api
 
 import (
-	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
@@ -27,29 +26,78 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"unicode/utf16"
-	"unicode/utf8"
+	"refes/config"
+	"time"
 )
 
-func Init(proto *string, address *string) error {
+const (
+	presenceInterval = time.Hour
+	onlineWindow     = 15 * time.Minute // users seen within this long are considered online
+)
+
+var conf *config.Config
+
+func Init(c *config.Config) error {
+	err := setup(c)
+	if err != nil {
+		return err
+	}
+
+	go logPresence()
+	go judgeContests()
+	go inductFamers()
+
+	if conf.Admin.Address != "" {
+		err = startAdmin()
+		if err != nil {
+			return err
+		}
+	}
+
 	http.HandleFunc("/", handleRequest)
 
-	log.Printf("INFO: server starting on %s\n", *address)
+	log.Printf("INFO: server starting on %s\n", conf.Listen.Address)
 
-	if *proto == "unix" {
-		os.Remove(*address)
+	listener, err := listen(conf.Listen, 0777)
+	if err != nil {
+		return err
 	}
 
-	listener, err := net.Listen(*proto, *address)
+	err = http.Serve(listener, nil)
 	if err != nil {
 		return err
 	}
 
-	if *proto == "unix" {
-		os.Chmod(*address, 0777)
+	return nil
+}
+
+// loads everything requests need without starting anything
+func setup(c *config.Config) error {
+	conf = c
+
+	err := loadRegions(conf.Regions)
+	if err != nil {
+		return err
 	}
 
-	err = http.Serve(listener, nil)
+	store, err = newStore()
+	if err != nil {
+		return err
+	}
+
+	blobs, err = newBlobStore()
+	if err != nil {
+		return err
+	}
+
+	err = loadZstd(conf.Blobs)
+	if err != nil {
+		return err
+	}
+
+	downloadCache = newGameCache(conf.Blobs.CacheSize << 20)
+
+	err = loadNgWords(conf.NgWords)
 	if err != nil {
 		return err
 	}
@@ -57,6 +105,45 @@ func Init(proto *string, address *string) error {
 	return nil
 }
 
+// unix sockets are replaced if they already exist and given the requested permissions
+func listen(l config.Listen, mode os.FileMode) (net.Listener, error) {
+	if l.Proto == "unix" {
+		os.Remove(l.Address)
+	}
+
+	listener, err := net.Listen(l.Proto, l.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Proto == "unix" {
+		os.Chmod(l.Address, mode)
+	}
+
+	return listener, nil
+}
+
+// periodically logs how many users are around
+func logPresence() {
+	for range time.Tick(presenceInterval) {
+		now := time.Now()
+
+		online, err := store.ActiveUserCount(now.Add(-onlineWindow))
+		if err != nil {
+			log.Printf("ERROR: failed to count online users: %s\n", err)
+			continue
+		}
+
+		daily, err := store.ActiveUserCount(now.Add(-24 * time.Hour))
+		if err != nil {
+			log.Printf("ERROR: failed to count daily active users: %s\n", err)
+			continue
+		}
+
+		log.Printf("INFO: %d users online, %d active today\n", online, daily)
+	}
+}
+
 func handleRequest(w http.ResponseWriter, r *http.Request) {
 	log.Printf("INFO: request to %s\n", r.RequestURI)
 
@@ -91,32 +178,32 @@ func handleRequest(w http.ResponseWriter, r *http.Request) {
 		body = []byte(bodyUnescaped[5:])
 	}
 
-	var response []byte
+	var resp response
 	switch r.RequestURI {
 	case "/api/username": // register username
-		response, err = handleUsername(body)
+		resp, err = asJSON(handleUsername(body))
 	case "/api/flags": // get server flags and user info
-		response, err = handleFlags(body)
+		resp, err = asJSON(handleFlags(body))
 	case "/api/signin": // make presence known to server?
-		response, err = handleSignIn(body)
+		resp, err = asJSON(handleSignIn(body))
 	case "/api/news": // get news
-		response, err = handleNews(body)
+		resp, err = handleNews(body)
 	case "/api/contestlist": // get contest list
-		response, err = handleContestList(body)
+		resp, err = asJSON(handleContestList(body))
 	case "/api/rpglist", "/api/rpglisttitle", "/api/rpglistuname", "/api/rpglistsuid", "/api/rpglistpassword": // get rpg list of some kind
-		response, err = handleRpgList(body, r.RequestURI[12:])
+		resp, err = asJSON(handleRpgList(body, r.RequestURI[12:]))
 	case "/api/myrpglist": // get your uploaded rpgs
-		response, err = handleMyRpgList(body)
+		resp, err = asJSON(handleMyRpgList(body))
 	case "/api/rpgdownload": // download rpg
-		response, err = handleRpgDownload(body)
+		resp, err = handleRpgDownload(body)
 	case "/api/rpgreview": // review rpg
-		response, err = handleRpgReview(body)
+		resp, err = asJSON(handleRpgReview(body))
 	case "/api/infomercial": // report rpg
-		response, err = handleInfomercial(body)
+		resp, err = asJSON(handleInfomercial(body))
 	case "/api/rpgupload": // upload rpg
-		response, err = handleRpgUpload(body)
+		resp, err = asJSON(handleRpgUpload(body))
 	case "/api/rpgdelete": // delete rpg
-		response, err = handleRpgDelete(body)
+		resp, err = asJSON(handleRpgDelete(body))
 	default:
 		err = fmt.Errorf("unknown endpoint: %s", r.RequestURI)
 	}
@@ -127,14 +214,8 @@ func handleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if utf8.Valid(response) {
-		respUtf16 := utf16.Encode([]rune(string(response)))
-
-		response = make([]byte, len(respUtf16)*2)
-		for i, v := range respUtf16 {
-			binary.LittleEndian.PutUint16(response[i*2:i*2+2], v)
-		}
+	err = resp.send(w)
+	if err != nil {
+		log.Printf("ERROR: failed to send response for %s: %s\n", r.RequestURI, err)
 	}
-
-	w.Write(response)
 }
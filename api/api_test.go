@@ -0,0 +1,43 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"path/filepath"
+	"refes/config"
+	"testing"
+)
+
+const testAdminToken = "secret"
+
+// an in memory server with its blobs in a temporary directory
+func setupTest(t *testing.T) {
+	t.Helper()
+
+	c := config.Default()
+	c.Database.Driver = "memory"
+	c.Blobs.Roots = []string{t.TempDir()}
+	c.NgWords = filepath.Join(t.TempDir(), "ngwords.txt")
+	c.Admin.Token = testAdminToken
+
+	err := setup(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,214 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"refes/config"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// game data is stored zstd compressed and addressed by the sha256 of the uncompressed data,
+// so the same game uploaded twice is only stored once
+type BlobStore interface {
+	Get(hash string) (io.ReadCloser, error)
+	Put(hash string, data []byte) error // data is already compressed
+	Delete(hash string) error
+	Stat(hash string) (BlobInfo, error)
+}
+
+type BlobInfo struct {
+	Size    int64 // compressed
+	ModTime time.Time
+}
+
+var blobs BlobStore
+
+var validHash = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// keeps a blob from being deleted while an upload is reusing it, uploads of different games don't wait on each other
+var (
+	blobLocksMu sync.Mutex
+	blobLocks   = make(map[string]*blobLock)
+)
+
+type blobLock struct {
+	sync.Mutex
+	waiters int
+}
+
+func lockBlob(hash string) (unlock func()) {
+	blobLocksMu.Lock()
+	lock, ok := blobLocks[hash]
+	if !ok {
+		lock = &blobLock{}
+		blobLocks[hash] = lock
+	}
+
+	lock.waiters++
+	blobLocksMu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		blobLocksMu.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(blobLocks, hash)
+		}
+		blobLocksMu.Unlock()
+	}
+}
+
+func newBlobStore() (BlobStore, error) {
+	switch conf.Blobs.Driver {
+	case "fs":
+		return newFSBlobStore(conf.Blobs.Roots)
+	case "s3":
+		return newS3BlobStore(conf.Blobs.S3)
+	}
+
+	return nil, fmt.Errorf("unknown blob driver: %s", conf.Blobs.Driver)
+}
+
+func blobHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// stores the game's data if it isn't already, then lists it
+func addGame(region *config.Region, game Game, data []byte) (int, error) {
+	game.Hash = blobHash(data)
+
+	unlock := lockBlob(game.Hash)
+	defer unlock()
+
+	_, err := blobs.Stat(game.Hash)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		err = blobs.Put(game.Hash, compressGame(data))
+		if err != nil {
+			return 0, err
+		}
+	case err != nil:
+		return 0, err
+	default:
+		log.Printf("INFO: reusing stored data for upload: %s\n", game.Hash)
+	}
+
+	sid, err := store.AddGame(region.Tables, game)
+	if err != nil {
+		// an orphaned blob is harmless, it's reused or collected the next time the hash is released
+		return 0, err
+	}
+
+	return sid, nil
+}
+
+// opens a game's data for reading
+func openGame(region *config.Region, game Game) (io.ReadCloser, error) {
+	compressed, err := openCompressedGame(region, game)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressGame(compressed)
+}
+
+// falls back to where games were kept before the blob store
+func openCompressedGame(region *config.Region, game Game) (io.ReadCloser, error) {
+	if game.Hash != "" {
+		return blobs.Get(game.Hash)
+	}
+
+	if region.GameDir == "" {
+		return nil, ErrNotFound
+	}
+
+	file, err := os.Open(gamePath(game.Sid, region))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// deletes a game's listing and its data once nothing else uses it
+func removeGame(region *config.Region, game Game) error {
+	err := store.DeleteGame(region.Tables, game.Sid)
+	if err != nil {
+		return err
+	}
+
+	if game.Hash == "" {
+		downloadCache.Remove(gameCacheKey(region, game))
+
+		if region.GameDir == "" {
+			return nil
+		}
+
+		err = os.Remove(gamePath(game.Sid, region))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	}
+
+	return releaseBlob(game.Hash)
+}
+
+func releaseBlob(hash string) error {
+	unlock := lockBlob(hash)
+	defer unlock()
+
+	// identical games can be in any region
+	for _, tables := range regionTables() {
+		refs, err := store.HashRefs(tables, hash)
+		if err != nil {
+			return err
+		}
+
+		if refs != 0 {
+			return nil
+		}
+	}
+
+	downloadCache.Remove(hash)
+
+	err := blobs.Delete(hash)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	return nil
+}
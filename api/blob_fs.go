@@ -0,0 +1,160 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// blobs are sharded by the first two bytes of their hash, ie root/ab/cd/abcd...zst
+type fsBlobStore struct {
+	roots []string
+}
+
+func newFSBlobStore(roots []string) (*fsBlobStore, error) {
+	if len(roots) == 0 {
+		return nil, errors.New("no blob roots configured")
+	}
+
+	err := os.MkdirAll(roots[0], 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fsBlobStore{roots: roots}, nil
+}
+
+func (s *fsBlobStore) path(root, hash string) (string, error) {
+	if !validHash.MatchString(hash) {
+		return "", fmt.Errorf("invalid blob hash: %q", hash)
+	}
+
+	return filepath.Join(root, hash[0:2], hash[2:4], hash+".zst"), nil
+}
+
+// finds the root a blob is in
+func (s *fsBlobStore) find(hash string) (string, os.FileInfo, error) {
+	for _, root := range s.roots {
+		path, err := s.path(root, hash)
+		if err != nil {
+			return "", nil, err
+		}
+
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		return path, info, nil
+	}
+
+	return "", nil, ErrNotFound
+}
+
+func (s *fsBlobStore) Get(hash string) (io.ReadCloser, error) {
+	path, _, err := s.find(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(path)
+}
+
+// written to a temporary file first so a partial blob is never served
+func (s *fsBlobStore) Put(hash string, data []byte) error {
+	path, err := s.path(s.roots[0], hash)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (s *fsBlobStore) Delete(hash string) error {
+	var found bool
+	for _, root := range s.roots {
+		path, err := s.path(root, hash)
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		found = true
+	}
+
+	if !found {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *fsBlobStore) Stat(hash string) (BlobInfo, error) {
+	_, info, err := s.find(hash)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	return BlobInfo{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
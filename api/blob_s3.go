@@ -0,0 +1,241 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"refes/config"
+	"sort"
+	"strings"
+	"time"
+)
+
+// requests are signed with aws signature version 4, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+type s3BlobStore struct {
+	conf   config.S3
+	client *http.Client
+}
+
+const (
+	s3Algorithm   = "AWS4-HMAC-SHA256"
+	s3DateFormat  = "20060102T150405Z"
+	s3EmptySha256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	s3Timeout = time.Minute // for connecting and for response headers
+)
+
+func newS3BlobStore(c config.S3) (*s3BlobStore, error) {
+	if c.Endpoint == "" || c.Bucket == "" {
+		return nil, errors.New("s3 blob store needs an endpoint and a bucket")
+	}
+
+	// no overall timeout, bodies are streamed to clients that may be slow to read them
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: s3Timeout}).DialContext
+	transport.ResponseHeaderTimeout = s3Timeout
+
+	return &s3BlobStore{
+		conf:   c,
+		client: &http.Client{Transport: transport},
+	}, nil
+}
+
+func (s *s3BlobStore) url(hash string) (string, error) {
+	if !validHash.MatchString(hash) {
+		return "", fmt.Errorf("invalid blob hash: %q", hash)
+	}
+
+	key := s.conf.Prefix + hash + ".zst"
+
+	return strings.TrimRight(s.conf.Endpoint, "/") + "/" + s3Escape(s.conf.Bucket) + "/" + s3Escape(key), nil
+}
+
+// sends a signed request, the caller closes the body of successful responses
+func (s *s3BlobStore) do(method, hash string, body []byte) (*http.Response, error) {
+	url, err := s.url(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	payloadHash := s3EmptySha256
+	if body != nil {
+		reader = bytes.NewReader(body)
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sign(req, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	return nil, fmt.Errorf("s3 %s %s failed: %s", method, hash, resp.Status)
+}
+
+func (s *s3BlobStore) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(s3DateFormat)
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// host and every x-amz-* header are signed, plus range for partial reads
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.conf.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := s3Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.conf.SecretKey)
+	for _, part := range []string{date, s.conf.Region, "s3", "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", s3Algorithm, s.conf.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapes everything but unreserved characters and slashes the way aws expects
+func s3Escape(s string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', strings.IndexByte("-._~/", b) != -1:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
+
+func (s *s3BlobStore) Get(hash string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, hash, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (s *s3BlobStore) Put(hash string, data []byte) error {
+	resp, err := s.do(http.MethodPut, hash, data)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *s3BlobStore) Delete(hash string) error {
+	resp, err := s.do(http.MethodDelete, hash, nil)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *s3BlobStore) Stat(hash string) (BlobInfo, error) {
+	resp, err := s.do(http.MethodHead, hash, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	resp.Body.Close()
+
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		modTime = time.Time{}
+	}
+
+	return BlobInfo{
+		Size:    resp.ContentLength,
+		ModTime: modTime,
+	}, nil
+}
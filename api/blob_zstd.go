@@ -0,0 +1,128 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"refes/config"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// one encoder is shared by every upload, EncodeAll is safe to use concurrently
+var zstdEncoder *zstd.Encoder
+
+// streaming decoders can only be used by one download at a time so they're pooled
+var zstdDecoders *decoderPool
+
+// decoders only know the dictionaries they were made with, so each configuration gets its own pool
+type decoderPool struct {
+	pool sync.Pool
+	opts []zstd.DOption
+}
+
+// dictionaries are made with "zstd --train" from a sample of games, new games are compressed
+// with the first one and the rest are kept so games compressed with them can still be read
+func loadZstd(c config.Blobs) error {
+	var dicts [][]byte
+	for _, path := range c.Dicts {
+		dict, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to load zstd dictionary: %w", err)
+		}
+
+		dicts = append(dicts, dict)
+	}
+
+	encoderOpts := []zstd.EOption{}
+	if c.Level != 0 {
+		encoderOpts = append(encoderOpts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.Level)))
+	}
+	if len(dicts) != 0 {
+		encoderOpts = append(encoderOpts, zstd.WithEncoderDict(dicts[0]))
+	}
+
+	encoder, err := zstd.NewWriter(nil, encoderOpts...)
+	if err != nil {
+		return err
+	}
+
+	// a single goroutine per decoder means nothing is left running when one is dropped from the pool
+	decoderOpts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if len(dicts) != 0 {
+		decoderOpts = append(decoderOpts, zstd.WithDecoderDicts(dicts...))
+	}
+
+	// catch bad dictionaries now rather than on the first download
+	decoder, err := zstd.NewReader(nil, decoderOpts...)
+	if err != nil {
+		encoder.Close()
+		return err
+	}
+
+	zstdEncoder = encoder
+	zstdDecoders = &decoderPool{opts: decoderOpts}
+	zstdDecoders.pool.Put(decoder)
+
+	return nil
+}
+
+func compressGame(data []byte) []byte {
+	return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/2))
+}
+
+// decompresses a game as it's read, closing it returns the decoder to the pool
+type gameReader struct {
+	*zstd.Decoder
+	src  io.ReadCloser
+	pool *decoderPool
+}
+
+func decompressGame(src io.ReadCloser) (io.ReadCloser, error) {
+	pool := zstdDecoders
+
+	decoder, ok := pool.pool.Get().(*zstd.Decoder)
+	if !ok {
+		var err error
+		decoder, err = zstd.NewReader(nil, pool.opts...)
+		if err != nil {
+			src.Close()
+			return nil, err
+		}
+	}
+
+	err := decoder.Reset(src)
+	if err != nil {
+		pool.pool.Put(decoder)
+		src.Close()
+		return nil, err
+	}
+
+	return &gameReader{Decoder: decoder, src: src, pool: pool}, nil
+}
+
+func (r *gameReader) Close() error {
+	r.Decoder.Reset(nil)
+	r.pool.pool.Put(r.Decoder)
+
+	return r.src.Close()
+}
@@ -0,0 +1,201 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"refes/config"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// testdata/sample.dict was made with "zstd --train --maxdict=16384" from sampleGame(1) through sampleGame(1000)
+
+var sampleWords = []string{"MAP", "EVENT", "SWITCH", "VARIABLE", "ITEM", "SWORD", "POTION", "HERO", "SLIME", "TOWN", "CASTLE", "Welcome!", "The door is locked.", "You got "}
+
+// roughly shaped like fes saves, small fixed size records with some text mixed in
+func sampleGame(seed int64) []byte {
+	r := rand.New(rand.NewSource(seed))
+
+	var game bytes.Buffer
+	for game.Len() < 64<<10 {
+		record := make([]byte, 8)
+		record[0] = byte(r.Intn(16))
+		binary.LittleEndian.PutUint16(record[1:], uint16(r.Intn(500)))
+		record[3] = byte(r.Intn(32))
+		record[4] = byte(r.Intn(32))
+		game.Write(record)
+
+		if r.Intn(4) == 0 {
+			game.WriteString(sampleWords[r.Intn(len(sampleWords))])
+			game.WriteByte(0)
+		}
+	}
+
+	return game.Bytes()
+}
+
+func TestZstdRoundTrip(t *testing.T) {
+	for _, c := range []config.Blobs{{}, {Level: 19}, {Dicts: []string{"testdata/sample.dict"}}} {
+		err := loadZstd(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := sampleGame(0)
+
+		reader, err := decompressGame(io.NopCloser(bytes.NewReader(compressGame(data))))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, data) {
+			t.Errorf("level %d, dicts %v: data changed", c.Level, c.Dicts)
+		}
+	}
+}
+
+// games compressed before a dictionary was configured have to stay readable
+func TestZstdWithoutDict(t *testing.T) {
+	err := loadZstd(config.Blobs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := sampleGame(0)
+	compressed := compressGame(data)
+
+	err = loadZstd(config.Blobs{Dicts: []string{"testdata/sample.dict"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := decompressGame(io.NopCloser(bytes.NewReader(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Error("data changed")
+	}
+}
+
+// how downloads were decompressed before the decoders were pooled
+func BenchmarkDecompressNewReader(b *testing.B) {
+	data := sampleGame(0)
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	compressed := encoder.EncodeAll(data, nil)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		decoder, err := zstd.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_, err = io.Copy(io.Discard, decoder)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		decoder.Close()
+	}
+}
+
+func BenchmarkDecompressPooled(b *testing.B) {
+	err := loadZstd(config.Blobs{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	data := sampleGame(0)
+	compressed := compressGame(data)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		reader, err := decompressGame(io.NopCloser(bytes.NewReader(compressed)))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_, err = io.Copy(io.Discard, reader)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		reader.Close()
+	}
+}
+
+// reports the compressed size as a fraction of the original
+func BenchmarkCompress(b *testing.B) {
+	data := sampleGame(0)
+
+	for _, level := range []int{1, 3, 9, 19} {
+		for _, dicts := range [][]string{nil, {"testdata/sample.dict"}} {
+			b.Run(fmt.Sprintf("level=%d/dict=%t", level, dicts != nil), func(b *testing.B) {
+				err := loadZstd(config.Blobs{Level: level, Dicts: dicts})
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				var compressed []byte
+
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					compressed = compressGame(data)
+				}
+
+				b.ReportMetric(float64(len(compressed))/float64(len(data)), "ratio")
+			})
+		}
+	}
+}
@@ -0,0 +1,157 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"container/list"
+	"refes/config"
+	"strconv"
+	"sync"
+)
+
+// keeps the most recently downloaded games decompressed in memory, a nil cache keeps nothing
+type gameCache struct {
+	mu      sync.Mutex
+	max     int // bytes
+	size    int
+	entries map[string]*list.Element
+	order   *list.List      // most recently used first
+	filling map[string]bool // keys a download is reading into memory
+}
+
+type gameCacheEntry struct {
+	key  string
+	data []byte
+}
+
+var downloadCache *gameCache
+
+func newGameCache(max int) *gameCache {
+	if max <= 0 {
+		return nil
+	}
+
+	return &gameCache{
+		max:     max,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		filling: make(map[string]bool),
+	}
+}
+
+// games are content addressed, older ones are keyed by where they are
+func gameCacheKey(region *config.Region, game Game) string {
+	if game.Hash != "" {
+		return game.Hash
+	}
+
+	return region.Tables + "/" + strconv.Itoa(game.Sid)
+}
+
+func (c *gameCache) Get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return element.Value.(*gameCacheEntry).data, true
+}
+
+// whether a game of the given size is worth reading into memory to add later
+func (c *gameCache) Fits(size int) bool {
+	return c != nil && size <= c.max
+}
+
+// claims a key for filling, false if it's already cached or being filled
+func (c *gameCache) StartFill(key string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok || c.filling[key] {
+		return false
+	}
+
+	c.filling[key] = true
+
+	return true
+}
+
+func (c *gameCache) EndFill(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.filling, key)
+}
+
+// data mustn't be modified once it's added
+func (c *gameCache) Add(key string, data []byte) {
+	if !c.Fits(len(data)) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&gameCacheEntry{key: key, data: data})
+	c.size += len(data)
+
+	for c.size > c.max {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *gameCache) Remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+func (c *gameCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*gameCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= len(entry.data)
+}
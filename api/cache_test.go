@@ -0,0 +1,118 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGameCacheEviction(t *testing.T) {
+	c := newGameCache(10)
+
+	c.Add("a", []byte("aaaa"))
+	c.Add("b", []byte("bbbb"))
+
+	// a is now the most recently used, so b goes first
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a missing")
+	}
+
+	c.Add("c", []byte("cccc"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b wasn't evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+
+	c.Add("big", make([]byte, 11))
+	if _, ok := c.Get("big"); ok {
+		t.Error("entry bigger than the cache was added")
+	}
+
+	if c.size != 8 {
+		t.Errorf("got size %d, want 8", c.size)
+	}
+}
+
+func TestGameCacheFill(t *testing.T) {
+	c := newGameCache(10)
+
+	if !c.StartFill("a") {
+		t.Fatal("first fill wasn't allowed")
+	}
+
+	if c.StartFill("a") {
+		t.Error("concurrent fill was allowed")
+	}
+
+	c.Add("a", []byte("a"))
+	c.EndFill("a")
+
+	if c.StartFill("a") {
+		t.Error("fill of a cached key was allowed")
+	}
+
+	var disabled *gameCache
+	if disabled.StartFill("a") || disabled.Fits(1) {
+		t.Error("disabled cache accepted a fill")
+	}
+}
+
+// downloads are posts, conditional headers can't be honoured on them
+func TestDownloadIgnoresConditionalHeaders(t *testing.T) {
+	setupTest(t)
+
+	uploadTestGame(t, "token", []byte("game"))
+
+	download, err := json.Marshal(RpgDownloadC{Sid: 1, Region: "USA", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/rpgdownload", bytes.NewReader(download))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-None-Match", "*")
+	req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+
+	rec := httptest.NewRecorder()
+	handleRequest(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "game" {
+		t.Fatalf("got status %d with %q, want the game", rec.Code, rec.Body.String())
+	}
+
+	game, err := store.Game("us", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if game.DlCount != 1 {
+		t.Errorf("got dlcount %d, want 1", game.DlCount)
+	}
+}
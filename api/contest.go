@@ -0,0 +1,122 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"log"
+	"time"
+)
+
+type ContestPhase int
+
+const (
+	ContestUpcoming   ContestPhase = iota
+	ContestApply                   // accepting entries
+	ContestReview                  // entries are being rated
+	ContestExhibition              // results are published
+	ContestClosed                  // between windows
+	ContestOver
+)
+
+const judgeInterval = time.Minute
+
+func (c Contest) Phase(now time.Time) ContestPhase {
+	switch {
+	case now.Before(c.ApplyStart):
+		return ContestUpcoming
+	case now.Before(c.ApplyEnd):
+		return ContestApply
+	case !now.Before(c.ReviewStart) && now.Before(c.ReviewEnd):
+		return ContestReview
+	case !now.Before(c.ExcStart) && now.Before(c.ExcEnd):
+		return ContestExhibition
+	case !now.Before(c.ExcEnd):
+		return ContestOver
+	}
+
+	return ContestClosed
+}
+
+// whether any of region's contests are in one of the given phases
+func contestInPhase(region string, now time.Time, phases ...ContestPhase) (bool, error) {
+	contests, err := store.Contests(region)
+	if err != nil {
+		return false, err
+	}
+
+	for _, contest := range contests {
+		current := contest.Phase(now)
+		for _, phase := range phases {
+			if current == phase {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// periodically gives out awards for contests whose review window has closed
+func judgeContests() {
+	for range time.Tick(judgeInterval) {
+		for _, region := range regionTables() {
+			err := judgeRegionContests(region, time.Now())
+			if err != nil {
+				log.Printf("ERROR: failed to judge contests for %s: %s\n", region, err)
+			}
+		}
+	}
+}
+
+func judgeRegionContests(region string, now time.Time) error {
+	contests, err := store.Contests(region)
+	if err != nil {
+		return err
+	}
+
+	for _, contest := range contests {
+		if contest.Judged || now.Before(contest.ReviewEnd) {
+			continue
+		}
+
+		ranking, err := store.ContestRanking(region, contest)
+		if err != nil {
+			return err
+		}
+
+		// award 0 is the grand prize, the rest follow in rank order
+		awards := make(map[int]int)
+		for rank, sid := range ranking {
+			if rank >= conf.ContestAwards {
+				break
+			}
+
+			awards[sid] = rank
+		}
+
+		err = store.SetContestAwards(region, contest.Id, awards)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("INFO: judged contest %d/%s, %d entries ranked\n", contest.Id, region, len(ranking))
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func january(day, hour int) time.Time {
+	return time.Date(2023, time.January, day, hour, 0, 0, 0, time.UTC)
+}
+
+// windows with gaps between them so every boundary is distinct
+var testContest = Contest{
+	Id:          1,
+	Name:        "test",
+	ApplyStart:  january(1, 0),
+	ApplyEnd:    january(10, 0),
+	ReviewStart: january(11, 0),
+	ReviewEnd:   january(20, 0),
+	ExcStart:    january(22, 0),
+	ExcEnd:      january(31, 0),
+}
+
+func TestContestPhase(t *testing.T) {
+	c := testContest
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want ContestPhase
+	}{
+		{"long before", january(1, 0).AddDate(0, -1, 0), ContestUpcoming},
+		{"before apply start", c.ApplyStart.Add(-time.Nanosecond), ContestUpcoming},
+		{"apply start", c.ApplyStart, ContestApply},
+		{"before apply end", c.ApplyEnd.Add(-time.Nanosecond), ContestApply},
+		{"apply end", c.ApplyEnd, ContestClosed},
+		{"before review start", c.ReviewStart.Add(-time.Nanosecond), ContestClosed},
+		{"review start", c.ReviewStart, ContestReview},
+		{"before review end", c.ReviewEnd.Add(-time.Nanosecond), ContestReview},
+		{"review end", c.ReviewEnd, ContestClosed},
+		{"before exc start", c.ExcStart.Add(-time.Nanosecond), ContestClosed},
+		{"exc start", c.ExcStart, ContestExhibition},
+		{"before exc end", c.ExcEnd.Add(-time.Nanosecond), ContestExhibition},
+		{"exc end", c.ExcEnd, ContestOver},
+		{"long after", c.ExcEnd.AddDate(1, 0, 0), ContestOver},
+	}
+
+	for _, test := range tests {
+		if got := c.Phase(test.now); got != test.want {
+			t.Errorf("%s (%s): got phase %d, want %d", test.name, test.now, got, test.want)
+		}
+	}
+}
+
+// windows that touch go straight from one phase to the next
+func TestContestPhaseAdjacent(t *testing.T) {
+	c := Contest{
+		ApplyStart:  january(1, 0),
+		ApplyEnd:    january(10, 0),
+		ReviewStart: january(10, 0),
+		ReviewEnd:   january(20, 0),
+		ExcStart:    january(20, 0),
+		ExcEnd:      january(31, 0),
+	}
+
+	tests := []struct {
+		now  time.Time
+		want ContestPhase
+	}{
+		{january(10, 0), ContestReview},
+		{january(20, 0), ContestExhibition},
+	}
+
+	for _, test := range tests {
+		if got := c.Phase(test.now); got != test.want {
+			t.Errorf("%s: got phase %d, want %d", test.now, got, test.want)
+		}
+	}
+}
+
+// the same instant is the same phase wherever it's observed from
+func TestContestPhaseTimezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2023-01-01 08:59 in tokyo is still 2022-12-31 in utc
+	now := time.Date(2023, time.January, 1, 8, 59, 0, 0, tokyo)
+	if got := testContest.Phase(now); got != ContestUpcoming {
+		t.Errorf("got phase %d, want %d", got, ContestUpcoming)
+	}
+
+	now = time.Date(2023, time.January, 1, 9, 0, 0, 0, tokyo)
+	if got := testContest.Phase(now); got != ContestApply {
+		t.Errorf("got phase %d, want %d", got, ContestApply)
+	}
+}
+
+func TestContestListEntryTimezone(t *testing.T) {
+	c := Contest{
+		Id:          1,
+		Name:        "test",
+		ApplyStart:  january(1, 0),
+		ApplyEnd:    january(10, 12),
+		ReviewStart: january(11, 0),
+		ReviewEnd:   january(20, 3),
+		ExcStart:    time.Date(2023, time.July, 1, 0, 0, 0, 0, time.UTC), // daylight saving in new york
+		ExcEnd:      time.Date(2023, time.July, 10, 0, 0, 0, 0, time.UTC),
+	}
+
+	now := january(5, 20)
+
+	tests := []struct {
+		location string
+		want     ContestListEntry
+	}{
+		{"UTC", ContestListEntry{
+			ApplyStart:  "2023-01-01 00:00:00",
+			ApplyEnd:    "2023-01-10 12:00:00",
+			ReviewStart: "2023-01-11 00:00:00",
+			ReviewEnd:   "2023-01-20 03:00:00",
+			ExcStart:    "2023-07-01 00:00:00",
+			ExcEnd:      "2023-07-10 00:00:00",
+			NowDate:     "2023-01-05 20:00:00",
+		}},
+		{"Asia/Tokyo", ContestListEntry{
+			ApplyStart:  "2023-01-01 09:00:00",
+			ApplyEnd:    "2023-01-10 21:00:00",
+			ReviewStart: "2023-01-11 09:00:00",
+			ReviewEnd:   "2023-01-20 12:00:00",
+			ExcStart:    "2023-07-01 09:00:00",
+			ExcEnd:      "2023-07-10 09:00:00",
+			NowDate:     "2023-01-06 05:00:00",
+		}},
+		{"America/New_York", ContestListEntry{
+			ApplyStart:  "2022-12-31 19:00:00",
+			ApplyEnd:    "2023-01-10 07:00:00",
+			ReviewStart: "2023-01-10 19:00:00",
+			ReviewEnd:   "2023-01-19 22:00:00",
+			ExcStart:    "2023-06-30 20:00:00",
+			ExcEnd:      "2023-07-09 20:00:00",
+			NowDate:     "2023-01-05 15:00:00",
+		}},
+	}
+
+	for _, test := range tests {
+		loc, err := time.LoadLocation(test.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test.want.Id = "1"
+		test.want.Name = "dGVzdA=="
+
+		if got := c.ContestListEntry(loc, now); got != test.want {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", test.location, got, test.want)
+		}
+	}
+}
+
+// contests were shown exactly as stored before regions had timezones, upgrading mustn't move them
+func TestDefaultRegionsShowStoredTimes(t *testing.T) {
+	setupTest(t)
+
+	for tables, loc := range regionLocations {
+		if loc != time.UTC {
+			t.Errorf("region %s shows times in %s by default", tables, loc)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"refes/config"
+	"strconv"
+	"time"
+)
+
+// the dashboard is served next to the admin api so moderators don't have to touch it directly
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+var dashboardTemplate = template.Must(template.New("index.html").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Format(timeFormat) },
+	"ave":  func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) },
+}).ParseFS(dashboardFiles, "dashboard/index.html"))
+
+const dashboardListSize = 20
+
+type dashboardReport struct {
+	Report
+	Game  Game
+	Found bool // a report filed while its game was being deleted can outlive it
+}
+
+// numbered like the info1-info6 fields clients send
+func (r dashboardReport) Categories() []int {
+	var categories []int
+	for i, info := range r.Info {
+		if info != 0 {
+			categories = append(categories, i+1)
+		}
+	}
+
+	return categories
+}
+
+type dashboardData struct {
+	Regions []string
+	Region  string
+	Stats   adminStatsS
+
+	Reports      []dashboardReport
+	Recent       []Game
+	TopDownloads []Game
+	TopRated     []Game
+}
+
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	tables := r.URL.Query().Get("region")
+	if tables == "" {
+		tables = defaultRegion.Tables
+	}
+
+	region, err := adminRegion(tables)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := loadDashboard(region)
+	if err != nil {
+		log.Printf("ERROR: failed to load dashboard: %s\n", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err = dashboardTemplate.Execute(w, data)
+	if err != nil {
+		log.Printf("ERROR: failed to render dashboard: %s\n", err)
+	}
+}
+
+func loadDashboard(region *config.Region) (dashboardData, error) {
+	data := dashboardData{
+		Regions: regionTables(),
+		Region:  region.Tables,
+	}
+
+	var err error
+	data.Stats, err = activeUserStats()
+	if err != nil {
+		return data, err
+	}
+
+	reports, err := store.Reports(region.Tables)
+	if err != nil {
+		return data, err
+	}
+
+	for _, report := range reports {
+		game, err := store.Game(region.Tables, report.Sid)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return data, err
+		}
+
+		data.Reports = append(data.Reports, dashboardReport{
+			Report: report,
+			Game:   game,
+			Found:  err == nil,
+		})
+	}
+
+	for _, list := range []struct {
+		games *[]Game
+		sort  string
+	}{
+		{&data.Recent, "updt"},
+		{&data.TopDownloads, "dlcount"},
+		{&data.TopRated, "reviewave"},
+	} {
+		*list.games, err = adminGames(region, GameQuery{
+			Sort:      list.sort,
+			Direction: "DESC",
+			Award:     -1,
+			Count:     dashboardListSize,
+		})
+		if err != nil {
+			return data, err
+		}
+	}
+
+	return data, nil
+}
+
+// form posts from the dashboard, redirects back to it when done
+func handleDashboardAction(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// browsers resend basic auth on their own, so only accept forms from the dashboard itself
+	// browsers always send an origin with posts, a missing or "null" one isn't trusted
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil || origin.Host == "" || origin.Host != r.Host {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	region, err := adminRegion(r.PostFormValue("region"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = dashboardAction(region, r.PostFormValue("action"), r.PostFormValue("id"))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("ERROR: dashboard action failed: %s\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/?region="+url.QueryEscape(region.Tables), http.StatusSeeOther)
+}
+
+// id is a sid for game actions and a suid for user actions
+func dashboardAction(region *config.Region, action, idStr string) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return fmt.Errorf("invalid id %q", idStr)
+	}
+
+	switch action {
+	case "hide", "restore":
+		return adminSetHidden(region, id, action == "hide")
+	case "resolve":
+		return adminResolveReports(region, id)
+	case "ban", "unban":
+		return adminSetBanned(id, action == "ban")
+	}
+
+	return fmt.Errorf("unknown action %q", action)
+}
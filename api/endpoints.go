@@ -19,13 +19,23 @@
 package api
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
 
-	"github.com/klauspost/compress/zstd"
+// star ratings
+const (
+	minReview = 1
+	maxReview = 5
 )
 
 func handleUsername(body []byte) ([]byte, error) {
@@ -35,10 +45,31 @@ func handleUsername(body []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	// TODO: do something here
+	_, err = getRegion(usernameC.Region, usernameC.Token)
+	if err != nil {
+		return nil, err
+	}
 
 	usernameS := &UsernameS{
-		EndCode: 0,
+		EndCode: EndCodeSuccess,
+	}
+
+	user, err := getUser(usernameC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	uname, err := decodeBase64(usernameC.Uname)
+	if err != nil {
+		return nil, err
+	}
+
+	usernameS.EndCode = validateUname(uname)
+	if usernameS.EndCode == EndCodeSuccess {
+		err = store.SetUname(user.Suid, uname)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	response, err := json.Marshal(usernameS)
@@ -56,20 +87,60 @@ func handleFlags(body []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	region, err := getRegion(flagsC.Region, flagsC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := getUser(flagsC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	newsId := -1 // disables news
+	lang := clientLang(region, flagsC.Lang)
+
+	id, err := store.NewsId(region.Tables, lang, now)
+	switch {
+	case err == nil:
+		newsId = id
+	case !errors.Is(err, ErrNotFound):
+		return nil, err
+	}
+
+	// contest mode while entries are being accepted, contest search once there are entries to look at
+	contestMode, err := contestInPhase(region.Tables, now, ContestApply)
+	if err != nil {
+		return nil, err
+	}
+
+	serchContest, err := contestInPhase(region.Tables, now, ContestReview, ContestExhibition)
+	if err != nil {
+		return nil, err
+	}
+
+	// the hall of fame tab is pointless until there's something in it
+	famers, err := store.Games(region.Tables, GameQuery{Award: -1, Famer: 1, Count: 1})
+	if err != nil {
+		return nil, err
+	}
+
 	flagsS := &FlagsS{
-		Id:                  "1", // placeholder
+		Id:                  strconv.Itoa(user.Suid),
 		Region:              flagsC.Region,
-		Lang:                flagsC.Lang,
-		Maintenance:         "0",
-		SerchContest:        "0",
-		SerchFamer:          "0",
-		SerchOtherCountries: "1",
-		ContestMode:         "0",
-		Suid:                "1",                                                     // placeholder
-		Uname:               base64.StdEncoding.EncodeToString([]byte("reFES User")), // placeholder
+		Lang:                lang,
+		Maintenance:         flag(conf.Maintenance),
+		SerchContest:        flag(serchContest),
+		SerchFamer:          flag(len(famers) != 0),
+		SerchOtherCountries: flag(len(browsableRegions(region)) > 1),
+		ContestMode:         flag(conf.ContestMode || contestMode),
+		Suid:                strconv.Itoa(user.Suid),
+		Uname:               base64.StdEncoding.EncodeToString([]byte(user.Uname)),
 		Flag1:               -1,
 		Flag2:               -1,
-		Flag3:               -1,
+		Flag3:               newsId,
 		EndCode:             0,
 	}
 
@@ -88,7 +159,22 @@ func handleSignIn(body []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	// TODO: do something here
+	region, err := getRegion(signInC.Region, signInC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := getUser(signInC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	lang := clientLang(region, signInC.Lang)
+
+	err = store.AddSignIn(user.Suid, signInC.Region, lang, time.Now())
+	if err != nil {
+		return nil, err
+	}
 
 	signInS := &SignInS{
 		EndCode: 0,
@@ -102,9 +188,27 @@ func handleSignIn(body []byte) ([]byte, error) {
 	return response, nil
 }
 
-func handleNews(body []byte) ([]byte, error) {
-	// TODO: do something here
-	return nil, errors.New("not implemented")
+// posts are stored exactly as the client expects them
+func handleNews(body []byte) (response, error) {
+	newsC := &NewsC{}
+	err := json.Unmarshal(body, newsC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := getRegion(newsC.Region, newsC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	lang := clientLang(region, newsC.Lang)
+
+	news, err := store.News(region.Tables, lang, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return binaryResponse(news), nil
 }
 
 func handleContestList(body []byte) ([]byte, error) {
@@ -114,13 +218,18 @@ func handleContestList(body []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	contestListEntries, err := getContestListEntries(contestListC.Region)
+	region, err := getRegion(contestListC.Region, contestListC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	contests, err := store.Contests(region.Tables)
 	if err != nil {
 		return nil, err
 	}
 
 	contestListS := &ContestListS{
-		ContestListEntries: contestListEntries,
+		ContestListEntries: contestListEntries(contests, regionLocation(region), time.Now()),
 		EndCode:            0,
 	}
 
@@ -139,6 +248,11 @@ func handleRpgList(body []byte, filter string) ([]byte, error) {
 		return nil, err
 	}
 
+	region, err := getRegion(rpgListC.Region, rpgListC.Token)
+	if err != nil {
+		return nil, err
+	}
+
 	// a lot of sanitization is done here
 
 	var sort string
@@ -171,13 +285,23 @@ func handleRpgList(body []byte, filter string) ([]byte, error) {
 		keyword = string(decoded)
 	}
 
-	rpgListEntries, err := getRpgListEntries(rpgListC.Region, filter, keyword, sort, direction, rpgListC.Contest, rpgListC.Award, rpgListC.Famer, rpgListC.RecNum, rpgListC.Offset)
+	games, err := browseGames(browsableRegions(region), GameQuery{
+		Filter:    filter,
+		Keyword:   keyword,
+		Sort:      sort,
+		Direction: direction,
+		Contest:   rpgListC.Contest,
+		Award:     rpgListC.Award,
+		Famer:     rpgListC.Famer,
+		Count:     rpgListC.RecNum,
+		Offset:    rpgListC.Offset,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	rpgListS := &RpgListS{
-		RpgListEntries: rpgListEntries,
+		RpgListEntries: rpgListEntries(region, games),
 		EndCode:        0,
 	}
 
@@ -190,65 +314,353 @@ func handleRpgList(body []byte, filter string) ([]byte, error) {
 }
 
 func handleMyRpgList(body []byte) ([]byte, error) {
-	// TODO: do something here
-	return nil, errors.New("not implemented")
+	myRpgListC := &MyRpgListC{}
+	err := json.Unmarshal(body, myRpgListC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := getRegion(myRpgListC.Region, myRpgListC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := getUser(myRpgListC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	games, err := store.UserGames(user.Suid)
+	if err != nil {
+		return nil, err
+	}
+
+	myRpgListS := &MyRpgListS{
+		RpgListEntries: rpgListEntries(region, games),
+		EndCode:        0,
+	}
+
+	response, err := json.Marshal(myRpgListS)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
 }
 
-func handleRpgDownload(body []byte) ([]byte, error) {
+// streamed so games are never held in memory whole, unless they're cached
+// downloads are posts, which proxies don't cache, so no validators are sent or checked
+func handleRpgDownload(body []byte) (response, error) {
 	rpgDownloadC := &RpgDownloadC{}
 	err := json.Unmarshal(body, rpgDownloadC)
 	if err != nil {
 		return nil, err
 	}
 
-	public, err := getRpgPublic(rpgDownloadC.Sid, rpgDownloadC.Region)
+	region, err := getRegion(rpgDownloadC.Region, rpgDownloadC.Token)
 	if err != nil {
 		return nil, err
 	}
 
-	if !public {
+	game, gameRegion, err := findPublicGame(region, rpgDownloadC.Sid)
+	if errors.Is(err, ErrNotFound) {
 		return nil, fmt.Errorf("attempt to download non-public game: %d/%s", rpgDownloadC.Sid, rpgDownloadC.Region)
 	}
+	if err != nil {
+		return nil, err
+	}
 
-	gameDir := "games_us"
-	if rpgDownloadC.Region == "JPN" || rpgDownloadC.Region == "" {
-		gameDir = "games_jp"
+	key := gameCacheKey(gameRegion, game)
+
+	var reader io.ReadCloser
+	data, cached := downloadCache.Get(key)
+	if cached {
+		reader = io.NopCloser(bytes.NewReader(data))
+	} else {
+		reader, err = openGame(gameRegion, game)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	file, err := os.ReadFile(fmt.Sprintf("%s/game%06d.zst", gameDir, rpgDownloadC.Sid))
+	return streamResponse(func(w http.ResponseWriter) error {
+		defer reader.Close()
+
+		// keep a copy while sending so the next download doesn't have to decompress it
+		// only one download fills the cache at a time, the rest are streamed as usual
+		var src io.Reader = reader
+		var buf *bytes.Buffer
+		if !cached && downloadCache.Fits(game.DataBlockSize) && downloadCache.StartFill(key) {
+			defer downloadCache.EndFill(key)
+
+			buf = bytes.NewBuffer(make([]byte, 0, game.DataBlockSize))
+			src = io.TeeReader(reader, buf)
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(game.DataBlockSize))
+
+		// too late to tell the client anything if this fails, it'll see the connection close early
+		n, err := io.Copy(w, src)
+		if err != nil {
+			return err
+		}
+
+		if n != int64(game.DataBlockSize) {
+			return fmt.Errorf("game %d/%s is %d bytes, expected %d", game.Sid, gameRegion.Tables, n, game.DataBlockSize)
+		}
+
+		if buf != nil {
+			downloadCache.Add(key, buf.Bytes())
+		}
+
+		return store.AddDownload(gameRegion.Tables, game.Sid)
+	}), nil
+}
+
+func handleRpgReview(body []byte) ([]byte, error) {
+	rpgReviewC := &RpgReviewC{}
+	err := json.Unmarshal(body, rpgReviewC)
 	if err != nil {
 		return nil, err
 	}
 
-	dec, err := zstd.NewReader(nil)
+	region, err := getRegion(rpgReviewC.Region, rpgReviewC.Token)
 	if err != nil {
 		return nil, err
 	}
 
-	decompressed, err := dec.DecodeAll(file, []byte{})
+	rpgReviewS := &RpgReviewS{
+		EndCode: EndCodeSuccess,
+	}
+
+	user, err := getUser(rpgReviewC.Token)
 	if err != nil {
 		return nil, err
 	}
 
-	return decompressed, nil
-}
+	game, gameRegion, err := findPublicGame(region, rpgReviewC.Sid)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		rpgReviewS.EndCode = EndCodeNotFound
+	case err != nil:
+		return nil, err
+	case rpgReviewC.Review < minReview || rpgReviewC.Review > maxReview:
+		rpgReviewS.EndCode = EndCodeInvalid
+	default:
+		err = store.SetReview(gameRegion.Tables, game.Sid, user.Suid, rpgReviewC.Review)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-func handleRpgReview(body []byte) ([]byte, error) {
-	// TODO: do something here
-	return nil, errors.New("not implemented")
+	response, err := json.Marshal(rpgReviewS)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
 }
 
 func handleInfomercial(body []byte) ([]byte, error) {
-	// TODO: do something here
-	return nil, errors.New("not implemented")
+	infomercialC := &InfomercialC{}
+	err := json.Unmarshal(body, infomercialC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := getRegion(infomercialC.Region, infomercialC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	infomercialS := &InfomercialS{
+		EndCode: EndCodeSuccess,
+	}
+
+	user, err := getUser(infomercialC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := decodeBase64(infomercialC.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	game, gameRegion, err := findPublicGame(region, infomercialC.Sid)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		infomercialS.EndCode = EndCodeNotFound
+	case err != nil:
+		return nil, err
+	default:
+		err = store.AddReport(gameRegion.Tables, Report{
+			Sid:  game.Sid,
+			Suid: user.Suid,
+			Info: [6]int{infomercialC.Info1, infomercialC.Info2, infomercialC.Info3, infomercialC.Info4, infomercialC.Info5, infomercialC.Info6},
+			Text: text,
+			Updt: time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("INFO: game reported by user %d: %d/%s\n", user.Suid, infomercialC.Sid, infomercialC.Region)
+	}
+
+	response, err := json.Marshal(infomercialS)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
 }
 
 func handleRpgUpload(body []byte) ([]byte, error) {
-	// TODO: do something here
-	return nil, errors.New("not implemented")
+	// the request is the json metadata with the game data immediately following it
+	rpgUploadC := &RpgUploadC{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	err := decoder.Decode(rpgUploadC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := getRegion(rpgUploadC.Region, rpgUploadC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	data := body[decoder.InputOffset():]
+
+	if len(data) != rpgUploadC.DataBlockSize {
+		return nil, fmt.Errorf("game data size mismatch: expected %d, got %d", rpgUploadC.DataBlockSize, len(data))
+	}
+
+	if crc32.ChecksumIEEE(data) != uint32(rpgUploadC.Crc32) {
+		return nil, fmt.Errorf("game data crc32 mismatch: expected %08x, got %08x", uint32(rpgUploadC.Crc32), crc32.ChecksumIEEE(data))
+	}
+
+	title, err := decodeBase64(rpgUploadC.Title)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := decodeBase64(rpgUploadC.Comment)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := strconv.Atoi(rpgUploadC.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := getUser(rpgUploadC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := newPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	if rpgUploadC.Contest != 0 {
+		contest, err := store.Contest(region.Tables, rpgUploadC.Contest)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+
+		if errors.Is(err, ErrNotFound) || contest.Phase(time.Now()) != ContestApply {
+			return json.Marshal(&RpgUploadS{
+				EndCode: EndCodeContestClosed,
+			})
+		}
+	}
+
+	lang := clientLang(region, rpgUploadC.Lang)
+
+	sid, err := addGame(region, Game{
+		Suid:           user.Suid,
+		Title:          title,
+		Uname:          user.Uname,
+		Password:       password,
+		Updt:           time.Now(),
+		DataBlockSize:  rpgUploadC.DataBlockSize,
+		Version:        version,
+		PackageVersion: rpgUploadC.PackageVersion,
+		Lang:           lang,
+		Edit:           rpgUploadC.Edit,
+		Attribute:      rpgUploadC.Attribute,
+		Award:          -1,
+		Comment:        comment,
+		Owner:          rpgUploadC.Owner,
+		Genre:          rpgUploadC.genres(),
+		Contest:        rpgUploadC.Contest,
+	}, data)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: game uploaded: %d/%s\n", sid, rpgUploadC.Region)
+
+	rpgUploadS := &RpgUploadS{
+		EndCode: 0,
+	}
+
+	response, err := json.Marshal(rpgUploadS)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
 }
 
 func handleRpgDelete(body []byte) ([]byte, error) {
-	// TODO: do something here
-	return nil, errors.New("not implemented")
+	rpgDeleteC := &RpgDeleteC{}
+	err := json.Unmarshal(body, rpgDeleteC)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := getRegion(rpgDeleteC.Region, rpgDeleteC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	rpgDeleteS := &RpgDeleteS{
+		EndCode: EndCodeSuccess,
+	}
+
+	user, err := getUser(rpgDeleteC.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	game, gameRegion, err := findGame(region, rpgDeleteC.Sid)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		rpgDeleteS.EndCode = EndCodeNotFound
+	case err != nil:
+		return nil, err
+	case game.Suid != user.Suid:
+		log.Printf("WARN: user %d attempted to delete game owned by %d: %d/%s\n", user.Suid, game.Suid, rpgDeleteC.Sid, rpgDeleteC.Region)
+
+		rpgDeleteS.EndCode = EndCodeNotOwner
+	default:
+		err = removeGame(gameRegion, game)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("INFO: game deleted: %d/%s\n", rpgDeleteC.Sid, rpgDeleteC.Region)
+	}
+
+	response, err := json.Marshal(rpgDeleteS)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
 }
@@ -0,0 +1,43 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"log"
+	"time"
+)
+
+const famerInterval = time.Hour
+
+// periodically inducts games that meet the configured hall of fame rules
+func inductFamers() {
+	for range time.Tick(famerInterval) {
+		for _, region := range regionTables() {
+			inducted, err := store.InductFamers(region, conf.Famer, time.Now())
+			if err != nil {
+				log.Printf("ERROR: failed to induct hall of fame games for %s: %s\n", region, err)
+				continue
+			}
+
+			if inducted != 0 {
+				log.Printf("INFO: inducted %d games into the %s hall of fame\n", inducted, region)
+			}
+		}
+	}
+}
@@ -0,0 +1,280 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"refes/config"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// global migrations run once, region migrations run for every table suffix with {{region}} replaced
+// the first mysql games and contests migrations adopt tables created before migrations existed
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+const globalScope = "global"
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// runs "up", "down" or "status" against the configured sql database
+// down reverts only the most recently applied migration, region migrations are reverted one region at a time
+func Migrate(c *config.Config, command string) error {
+	conf = c
+
+	err := loadRegions(conf.Regions)
+	if err != nil {
+		return err
+	}
+
+	var s *sqlStore
+	switch conf.Database.Driver {
+	case "mysql":
+		s, err = newMysqlStore(conf.Database.DSN(), regionTables())
+	case "sqlite":
+		s, err = newSqliteStore(conf.Database.Path, regionTables())
+	default:
+		return fmt.Errorf("migrations are only supported by the mysql and sqlite drivers, not %s", conf.Database.Driver)
+	}
+	if err != nil {
+		return err
+	}
+
+	defer s.db.Close()
+
+	return s.migrate(command)
+}
+
+func (s *sqlStore) migrate(command string) error {
+	_, err := s.db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (scope VARCHAR(16) NOT NULL, version INT NOT NULL, applied DATETIME NOT NULL, PRIMARY KEY (scope, version))")
+	if err != nil {
+		return err
+	}
+
+	// the migration down reverts, ties are broken by the order up applies them in
+	var newest struct {
+		scope     string
+		migration migration
+		applied   time.Time
+	}
+
+	scopes := append([]string{globalScope}, s.regions...)
+	for _, scope := range scopes {
+		dir := "region"
+		if scope == globalScope {
+			dir = "global"
+		}
+
+		migrations, err := loadMigrations(s.driver, dir, scope)
+		if err != nil {
+			return err
+		}
+
+		applied, err := appliedMigrations(s.db, scope)
+		if err != nil {
+			return err
+		}
+
+		switch command {
+		case "up":
+			err = migrateUp(s.db, scope, migrations, applied)
+		case "down":
+			for _, m := range migrations {
+				if t, ok := applied[m.version]; ok && !t.Before(newest.applied) {
+					newest.scope, newest.migration, newest.applied = scope, m, t
+				}
+			}
+		case "status":
+			for _, m := range migrations {
+				status := "pending"
+				if t, ok := applied[m.version]; ok {
+					status = "applied " + t.Format(timeFormat)
+				}
+
+				fmt.Printf("%-8s %04d %-16s %s\n", scope, m.version, m.name, status)
+			}
+		default:
+			return fmt.Errorf("unknown migrate command: %s", command)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if command == "down" {
+		if newest.scope == "" {
+			fmt.Println("no migrations to revert")
+			return nil
+		}
+
+		return migrateDown(s.db, newest.scope, newest.migration)
+	}
+
+	return nil
+}
+
+func migrateUp(db *sql.DB, scope string, migrations []migration, applied map[int]time.Time) error {
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+
+		err := execStatements(db, m.up)
+		if err != nil {
+			return fmt.Errorf("migration %s/%04d_%s failed: %w", scope, m.version, m.name, err)
+		}
+
+		_, err = db.Exec("INSERT INTO schema_migrations (scope, version, applied) VALUES (?, ?, ?)", scope, m.version, time.Now())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%-8s %04d %-16s applied\n", scope, m.version, m.name)
+	}
+
+	return nil
+}
+
+func migrateDown(db *sql.DB, scope string, m migration) error {
+	err := execStatements(db, m.down)
+	if err != nil {
+		return fmt.Errorf("migration %s/%04d_%s failed: %w", scope, m.version, m.name, err)
+	}
+
+	_, err = db.Exec("DELETE FROM schema_migrations WHERE scope = ? AND version = ?", scope, m.version)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-8s %04d %-16s reverted\n", scope, m.version, m.name)
+
+	return nil
+}
+
+// the driver doesn't allow more than one statement per query
+func execStatements(db *sql.DB, statements string) error {
+	for _, statement := range strings.Split(statements, ";\n") {
+		statement = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";"))
+		if statement == "" {
+			continue
+		}
+
+		_, err := db.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func appliedMigrations(db *sql.DB, scope string) (map[int]time.Time, error) {
+	results, err := db.Query("SELECT version, applied FROM schema_migrations WHERE scope = ?", scope)
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	applied := make(map[int]time.Time)
+	for results.Next() {
+		var version int
+		var t time.Time
+		err := results.Scan(&version, &t)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[version] = t
+	}
+
+	return applied, results.Err()
+}
+
+// file names are NNNN_name.up.sql and NNNN_name.down.sql, each driver has its own
+func loadMigrations(driver, dir, region string) ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, path.Join("migrations", driver, dir))
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		name, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("malformed migration file name: %s", entry.Name())
+		}
+
+		number, name, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("malformed migration file name: %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("malformed migration file name: %s", entry.Name())
+		}
+
+		file, err := migrationFiles.ReadFile(path.Join("migrations", driver, dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		statements := strings.ReplaceAll(string(file), "{{region}}", region)
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+
+		if direction == "up" {
+			m.up = statements
+		} else {
+			m.down = statements
+		}
+	}
+
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, errors.New("migration is missing its up or down file: " + m.name)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	return migrations, nil
+}
@@ -0,0 +1,123 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func appliedVersions(t *testing.T, s *sqlStore, scope string) map[int]time.Time {
+	t.Helper()
+
+	applied, err := appliedMigrations(s.db, scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return applied
+}
+
+func TestMigrateDownRevertsOne(t *testing.T) {
+	s, err := newSqliteStore(filepath.Join(t.TempDir(), "refes.db"), testStoreRegions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrateTestStore(t, s)
+
+	// everything applied in the same run, then users.banned added on its own later
+	applied := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	_, err = s.db.Exec("UPDATE schema_migrations SET applied = ?", applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.db.Exec("UPDATE schema_migrations SET applied = ? WHERE scope = ? AND version = 4", applied.Add(time.Hour), globalScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.migrate("down")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := appliedVersions(t, s, globalScope)[4]; ok {
+		t.Error("global 0004 wasn't reverted")
+	}
+
+	_, err = s.db.Exec("SELECT banned FROM users")
+	if err == nil {
+		t.Error("users.banned still exists")
+	}
+
+	for _, region := range testStoreRegions {
+		if n := len(appliedVersions(t, s, region)); n != 8 {
+			t.Errorf("%s has %d migrations applied, want all 8", region, n)
+		}
+	}
+
+	// with nothing newer, ties go to the last migration up applied
+	err = s.migrate("down")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(appliedVersions(t, s, "jp")); n != 8 {
+		t.Errorf("jp has %d migrations applied, want all 8", n)
+	}
+
+	if _, ok := appliedVersions(t, s, "us")[8]; ok {
+		t.Error("us 0008 wasn't reverted")
+	}
+
+	if n := len(appliedVersions(t, s, globalScope)); n != 3 {
+		t.Errorf("global has %d migrations applied, want 3", n)
+	}
+}
+
+// every migration has to revert cleanly, newest first
+func TestMigrateDownAll(t *testing.T) {
+	s, err := newSqliteStore(filepath.Join(t.TempDir(), "refes.db"), testStoreRegions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrateTestStore(t, s)
+
+	// 4 global and 8 for each region
+	for i := 0; i < 4+8*len(testStoreRegions); i++ {
+		err = s.migrate("down")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tables int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')").Scan(&tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tables != 0 {
+		t.Errorf("%d tables are left after reverting everything", tables)
+	}
+}
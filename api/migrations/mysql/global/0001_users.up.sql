@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS users (
+	suid INT NOT NULL AUTO_INCREMENT,
+	token VARCHAR(255) NOT NULL,
+	uname VARCHAR(255) NOT NULL,
+	created DATETIME NOT NULL,
+	lastseen DATETIME NULL,
+	PRIMARY KEY (suid),
+	UNIQUE KEY (token),
+	KEY (lastseen)
+) DEFAULT CHARSET=utf8mb4;
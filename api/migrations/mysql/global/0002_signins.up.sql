@@ -0,0 +1,10 @@
+CREATE TABLE signins (
+	id BIGINT NOT NULL AUTO_INCREMENT,
+	suid INT NOT NULL,
+	region VARCHAR(8) NOT NULL,
+	lang VARCHAR(8) NOT NULL,
+	date DATETIME NOT NULL,
+	PRIMARY KEY (id),
+	KEY (suid),
+	KEY (date)
+) DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,10 @@
+CREATE TABLE news (
+	id INT NOT NULL AUTO_INCREMENT,
+	region VARCHAR(8) NOT NULL DEFAULT '',
+	lang VARCHAR(8) NOT NULL DEFAULT '',
+	body MEDIUMBLOB NOT NULL,
+	publish DATETIME NOT NULL,
+	expire DATETIME NULL,
+	PRIMARY KEY (id),
+	KEY (publish)
+) DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+ALTER TABLE users ADD banned TINYINT(1) NOT NULL DEFAULT 0;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS games_{{region}} (
+	sid INT NOT NULL AUTO_INCREMENT,
+	suid INT NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	uname VARCHAR(255) NOT NULL,
+	password VARCHAR(16) NOT NULL,
+	updt DATETIME NOT NULL,
+	datablocksize INT NOT NULL,
+	version INT NOT NULL,
+	packageversion INT NOT NULL,
+	reviewave DOUBLE NOT NULL DEFAULT 0,
+	lang VARCHAR(8) NOT NULL,
+	edit INT NOT NULL,
+	attribute INT NOT NULL,
+	award INT NOT NULL DEFAULT -1,
+	famer INT NOT NULL DEFAULT 0,
+	comment TEXT NOT NULL,
+	contest INT NOT NULL DEFAULT 0,
+	owner INT NOT NULL,
+	genre VARCHAR(128) NOT NULL,
+	dlcount INT NOT NULL DEFAULT 0,
+	PRIMARY KEY (sid),
+	KEY (suid),
+	KEY (password)
+) DEFAULT CHARSET=utf8mb4;
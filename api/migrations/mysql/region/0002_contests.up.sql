@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS contests_{{region}} (
+	id INT NOT NULL AUTO_INCREMENT,
+	name VARCHAR(255) NOT NULL,
+	apply_start DATETIME NOT NULL,
+	apply_end DATETIME NOT NULL,
+	review_start DATETIME NOT NULL,
+	review_end DATETIME NOT NULL,
+	exc_start DATETIME NOT NULL,
+	exc_end DATETIME NOT NULL,
+	PRIMARY KEY (id)
+) DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+DROP TABLE reviews_{{region}};
@@ -0,0 +1,7 @@
+CREATE TABLE reviews_{{region}} (
+	sid INT NOT NULL,
+	suid INT NOT NULL,
+	review INT NOT NULL,
+	updt DATETIME NOT NULL,
+	PRIMARY KEY (sid, suid)
+) DEFAULT CHARSET=utf8mb4;
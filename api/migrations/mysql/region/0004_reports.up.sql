@@ -0,0 +1,14 @@
+CREATE TABLE reports_{{region}} (
+	sid INT NOT NULL,
+	suid INT NOT NULL,
+	info1 INT NOT NULL,
+	info2 INT NOT NULL,
+	info3 INT NOT NULL,
+	info4 INT NOT NULL,
+	info5 INT NOT NULL,
+	info6 INT NOT NULL,
+	text TEXT NOT NULL,
+	updt DATETIME NOT NULL,
+	PRIMARY KEY (sid, suid),
+	KEY (updt)
+) DEFAULT CHARSET=utf8mb4;
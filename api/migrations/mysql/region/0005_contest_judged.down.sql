@@ -0,0 +1 @@
+ALTER TABLE contests_{{region}} DROP COLUMN judged;
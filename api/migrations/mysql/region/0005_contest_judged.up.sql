@@ -0,0 +1 @@
+ALTER TABLE contests_{{region}} ADD judged TINYINT(1) NOT NULL DEFAULT 0;
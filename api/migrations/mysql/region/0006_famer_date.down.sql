@@ -0,0 +1 @@
+ALTER TABLE games_{{region}} DROP COLUMN famerdate;
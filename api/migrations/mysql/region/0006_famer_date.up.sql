@@ -0,0 +1 @@
+ALTER TABLE games_{{region}} ADD famerdate DATETIME NULL;
@@ -0,0 +1 @@
+ALTER TABLE games_{{region}} ADD hidden TINYINT(1) NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP INDEX hash ON games_{{region}};
+ALTER TABLE games_{{region}} DROP COLUMN hash;
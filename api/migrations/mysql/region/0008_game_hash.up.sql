@@ -0,0 +1,2 @@
+ALTER TABLE games_{{region}} ADD hash CHAR(64) NOT NULL DEFAULT '';
+CREATE INDEX hash ON games_{{region}} (hash);
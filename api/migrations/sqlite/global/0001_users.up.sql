@@ -0,0 +1,8 @@
+CREATE TABLE users (
+	suid INTEGER PRIMARY KEY AUTOINCREMENT,
+	token TEXT NOT NULL UNIQUE,
+	uname TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	lastseen DATETIME NULL
+);
+CREATE INDEX users_lastseen ON users (lastseen);
@@ -0,0 +1,9 @@
+CREATE TABLE signins (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	suid INTEGER NOT NULL,
+	region TEXT NOT NULL,
+	lang TEXT NOT NULL,
+	date DATETIME NOT NULL
+);
+CREATE INDEX signins_suid ON signins (suid);
+CREATE INDEX signins_date ON signins (date);
@@ -0,0 +1,9 @@
+CREATE TABLE news (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	region TEXT NOT NULL DEFAULT '',
+	lang TEXT NOT NULL DEFAULT '',
+	body BLOB NOT NULL,
+	publish DATETIME NOT NULL,
+	expire DATETIME NULL
+);
+CREATE INDEX news_publish ON news (publish);
@@ -0,0 +1 @@
+ALTER TABLE users ADD banned BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,24 @@
+CREATE TABLE games_{{region}} (
+	sid INTEGER PRIMARY KEY AUTOINCREMENT,
+	suid INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	uname TEXT NOT NULL,
+	password TEXT NOT NULL,
+	updt DATETIME NOT NULL,
+	datablocksize INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	packageversion INTEGER NOT NULL,
+	reviewave REAL NOT NULL DEFAULT 0,
+	lang TEXT NOT NULL,
+	edit INTEGER NOT NULL,
+	attribute INTEGER NOT NULL,
+	award INTEGER NOT NULL DEFAULT -1,
+	famer INTEGER NOT NULL DEFAULT 0,
+	comment TEXT NOT NULL,
+	contest INTEGER NOT NULL DEFAULT 0,
+	owner INTEGER NOT NULL,
+	genre TEXT NOT NULL,
+	dlcount INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX games_{{region}}_suid ON games_{{region}} (suid);
+CREATE INDEX games_{{region}}_password ON games_{{region}} (password);
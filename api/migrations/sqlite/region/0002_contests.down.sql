@@ -0,0 +1 @@
+DROP TABLE contests_{{region}};
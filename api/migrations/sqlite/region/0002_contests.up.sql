@@ -0,0 +1,10 @@
+CREATE TABLE contests_{{region}} (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	apply_start DATETIME NOT NULL,
+	apply_end DATETIME NOT NULL,
+	review_start DATETIME NOT NULL,
+	review_end DATETIME NOT NULL,
+	exc_start DATETIME NOT NULL,
+	exc_end DATETIME NOT NULL
+);
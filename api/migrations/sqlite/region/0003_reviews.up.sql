@@ -0,0 +1,7 @@
+CREATE TABLE reviews_{{region}} (
+	sid INTEGER NOT NULL,
+	suid INTEGER NOT NULL,
+	review INTEGER NOT NULL,
+	updt DATETIME NOT NULL,
+	PRIMARY KEY (sid, suid)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE reports_{{region}} (
+	sid INTEGER NOT NULL,
+	suid INTEGER NOT NULL,
+	info1 INTEGER NOT NULL,
+	info2 INTEGER NOT NULL,
+	info3 INTEGER NOT NULL,
+	info4 INTEGER NOT NULL,
+	info5 INTEGER NOT NULL,
+	info6 INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	updt DATETIME NOT NULL,
+	PRIMARY KEY (sid, suid)
+);
+CREATE INDEX reports_{{region}}_updt ON reports_{{region}} (updt);
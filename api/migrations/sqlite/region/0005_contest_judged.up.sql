@@ -0,0 +1 @@
+ALTER TABLE contests_{{region}} ADD judged BOOLEAN NOT NULL DEFAULT 0;
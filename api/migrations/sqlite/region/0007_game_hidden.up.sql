@@ -0,0 +1 @@
+ALTER TABLE games_{{region}} ADD hidden BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP INDEX games_{{region}}_hash;
+ALTER TABLE games_{{region}} DROP COLUMN hash;
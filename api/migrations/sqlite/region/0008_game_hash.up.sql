@@ -0,0 +1,2 @@
+ALTER TABLE games_{{region}} ADD hash TEXT NOT NULL DEFAULT '';
+CREATE INDEX games_{{region}}_hash ON games_{{region}} (hash);
@@ -0,0 +1,236 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"encoding/base64"
+	"refes/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timeFormat = "2006-01-02 15:04:05"
+
+// json tags are for the admin api, clients get the *ListEntry conversions
+type Game struct {
+	Sid            int       `json:"sid"`
+	Suid           int       `json:"suid"`
+	Title          string    `json:"title"`
+	Uname          string    `json:"uname"`
+	Password       string    `json:"password"`
+	Updt           time.Time `json:"updt"`
+	DataBlockSize  int       `json:"datablocksize"`
+	Version        int       `json:"version"`
+	PackageVersion int       `json:"packageversion"`
+	ReviewAve      float64   `json:"reviewave"`
+	Lang           string    `json:"lang"`
+	Edit           int       `json:"edit"`
+	Attribute      int       `json:"attribute"`
+	Award          int       `json:"award"` // -1 if the game hasn't won anything
+	Famer          int       `json:"famer"`
+	FamerDate      time.Time `json:"famerdate"` // when the game was inducted into the hall of fame, zero if it never was
+	Comment        string    `json:"comment"`
+	Contest        int       `json:"contest"`
+	Owner          int       `json:"owner"`
+	Genre          string    `json:"genre"` // comma separated genre numbers
+	DlCount        int       `json:"dlcount"`
+	Hidden         bool      `json:"hidden"` // taken down by a moderator
+	Hash           string    `json:"hash"`   // sha256 of the game data, empty for games stored before the blob store
+
+	Region string `json:"region"` // table suffix of the region the game is in, not stored
+}
+
+// times are stored in UTC and shown in their region's timezone, regions without one show them as stored
+// like before timezones existed, so contests entered in local time need converting before a region gets one
+type Contest struct {
+	Id          int       `json:"id"`
+	Name        string    `json:"name"`
+	ApplyStart  time.Time `json:"apply_start"`
+	ApplyEnd    time.Time `json:"apply_end"`
+	ReviewStart time.Time `json:"review_start"`
+	ReviewEnd   time.Time `json:"review_end"`
+	ExcStart    time.Time `json:"exc_start"`
+	ExcEnd      time.Time `json:"exc_end"`
+	Judged      bool      `json:"judged"` // awards have been given out
+}
+
+type User struct {
+	Suid   int    `json:"suid"`
+	Uname  string `json:"uname"`
+	Banned bool   `json:"banned"`
+}
+
+type Report struct {
+	Sid  int       `json:"sid"`
+	Suid int       `json:"suid"`
+	Info [6]int    `json:"info"` // report categories
+	Text string    `json:"text"`
+	Updt time.Time `json:"updt"`
+}
+
+// an empty region or lang targets everyone
+type News struct {
+	Id      int       `json:"id"`
+	Region  string    `json:"region"`
+	Lang    string    `json:"lang"`
+	Body    []byte    `json:"body"`
+	Publish time.Time `json:"publish"`
+	Expire  time.Time `json:"expire"` // zero if the post doesn't expire
+}
+
+func (g Game) RpgListEntry() RpgListEntry {
+	rpgListEntry := RpgListEntry{
+		Sid:            strconv.Itoa(g.Sid),
+		Suid:           strconv.Itoa(g.Suid),
+		Title:          base64.StdEncoding.EncodeToString([]byte(g.Title)),
+		Uname:          base64.StdEncoding.EncodeToString([]byte(g.Uname)),
+		Password:       g.Password,
+		Updt:           g.Updt.Format(timeFormat),
+		DataBlockSize:  strconv.Itoa(g.DataBlockSize),
+		Version:        strconv.Itoa(g.Version),
+		PackageVersion: strconv.Itoa(g.PackageVersion),
+		ReviewAve:      strconv.FormatFloat(g.ReviewAve, 'f', 5, 64),
+		Lang:           g.Lang,
+		Edit:           strconv.Itoa(g.Edit),
+		Attribute:      strconv.Itoa(g.Attribute),
+		Award:          strconv.Itoa(g.Award),
+		Famer:          strconv.Itoa(g.Famer),
+		Comment:        base64.StdEncoding.EncodeToString([]byte(g.Comment)),
+		Contest:        strconv.Itoa(g.Contest),
+		Owner:          strconv.Itoa(g.Owner),
+		DlCount:        strconv.Itoa(g.DlCount),
+	}
+
+	// the genre system is so bad there's probably no better way to do this
+	for _, str := range strings.Split(g.Genre, ",") {
+		switch str {
+		case "1":
+			rpgListEntry.Genre1 = "1"
+		case "2":
+			rpgListEntry.Genre2 = "1"
+		case "3":
+			rpgListEntry.Genre3 = "1"
+		case "4":
+			rpgListEntry.Genre4 = "1"
+		case "5":
+			rpgListEntry.Genre5 = "1"
+		case "6":
+			rpgListEntry.Genre6 = "1"
+		case "7":
+			rpgListEntry.Genre7 = "1"
+		case "8":
+			rpgListEntry.Genre8 = "1"
+		case "9":
+			rpgListEntry.Genre9 = "1"
+		case "10":
+			rpgListEntry.Genre10 = "1"
+		case "11":
+			rpgListEntry.Genre11 = "1"
+		case "12":
+			rpgListEntry.Genre12 = "1"
+		case "13":
+			rpgListEntry.Genre13 = "1"
+		case "14":
+			rpgListEntry.Genre14 = "1"
+		case "15":
+			rpgListEntry.Genre15 = "1"
+		case "16":
+			rpgListEntry.Genre16 = "1"
+		case "17":
+			rpgListEntry.Genre17 = "1"
+		case "18":
+			rpgListEntry.Genre18 = "1"
+		case "19":
+			rpgListEntry.Genre19 = "1"
+		case "20":
+			rpgListEntry.Genre20 = "1"
+		case "21":
+			rpgListEntry.Genre21 = "1"
+		case "22":
+			rpgListEntry.Genre22 = "1"
+		case "23":
+			rpgListEntry.Genre23 = "1"
+		case "24":
+			rpgListEntry.Genre24 = "1"
+		case "25":
+			rpgListEntry.Genre25 = "1"
+		case "26":
+			rpgListEntry.Genre26 = "1"
+		case "27":
+			rpgListEntry.Genre27 = "1"
+		case "28":
+			rpgListEntry.Genre28 = "1"
+		case "29":
+			rpgListEntry.Genre29 = "1"
+		case "30":
+			rpgListEntry.Genre30 = "1"
+		case "31":
+			rpgListEntry.Genre31 = "1"
+		case "32":
+			rpgListEntry.Genre32 = "1"
+		case "33":
+			rpgListEntry.Genre33 = "1"
+		case "34":
+			rpgListEntry.Genre34 = "1"
+		}
+	}
+
+	return rpgListEntry
+}
+
+// times are sent in loc along with the server's clock so the client can work out the current phase
+func (c Contest) ContestListEntry(loc *time.Location, now time.Time) ContestListEntry {
+	return ContestListEntry{
+		Id:          strconv.Itoa(c.Id),
+		Name:        base64.StdEncoding.EncodeToString([]byte(c.Name)),
+		ApplyStart:  c.ApplyStart.In(loc).Format(timeFormat),
+		ApplyEnd:    c.ApplyEnd.In(loc).Format(timeFormat),
+		ReviewStart: c.ReviewStart.In(loc).Format(timeFormat),
+		ReviewEnd:   c.ReviewEnd.In(loc).Format(timeFormat),
+		ExcStart:    c.ExcStart.In(loc).Format(timeFormat),
+		ExcEnd:      c.ExcEnd.In(loc).Format(timeFormat),
+		NowDate:     now.In(loc).Format(timeFormat),
+	}
+}
+
+// numbers the games in the order they're given, games from outside region are tagged with where they're from
+func rpgListEntries(region *config.Region, games []Game) map[string]RpgListEntry {
+	rpgListEntries := make(map[string]RpgListEntry)
+	for i, game := range games {
+		rpgListEntry := game.RpgListEntry()
+		if game.Region != region.Tables {
+			rpgListEntry.Sid = strconv.Itoa(clientSid(region, game))
+			rpgListEntry.Region = primaryCode(regionsByTables[game.Region])
+		}
+
+		rpgListEntries[strconv.Itoa(i)] = rpgListEntry
+	}
+
+	return rpgListEntries
+}
+
+func contestListEntries(contests []Contest, loc *time.Location, now time.Time) map[string]ContestListEntry {
+	contestListEntries := make(map[string]ContestListEntry)
+	for i, contest := range contests {
+		contestListEntries[strconv.Itoa(i)] = contest.ContestListEntry(loc, now)
+	}
+
+	return contestListEntries
+}
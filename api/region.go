@@ -0,0 +1,237 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"refes/config"
+	"regexp"
+	"time"
+	_ "time/tzdata" // so timezones work without the system database
+)
+
+var (
+	regionsByCode   map[string]*config.Region
+	regionsById     map[int]*config.Region
+	regionsByTables map[string]*config.Region
+	regionLocations map[string]*time.Location // by table suffix
+	defaultRegion   *config.Region
+)
+
+// sids from other regions are shown to clients as id*foreignSidBase+sid so they don't collide
+const (
+	foreignSidBase = 100000000
+	maxRegionId    = 20 // keeps foreign sids within an int32
+)
+
+// table suffixes end up in queries so keep them boring
+var validTables = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func loadRegions(regions []config.Region) error {
+	regionsByCode = make(map[string]*config.Region)
+	regionsById = make(map[int]*config.Region)
+	regionsByTables = make(map[string]*config.Region)
+	regionLocations = make(map[string]*time.Location)
+	defaultRegion = nil
+
+	for i := range regions {
+		region := &regions[i]
+
+		if !validTables.MatchString(region.Tables) {
+			return fmt.Errorf("invalid region table suffix: %q", region.Tables)
+		}
+
+		if _, ok := regionsByTables[region.Tables]; ok {
+			return fmt.Errorf("region table suffix used more than once: %s", region.Tables)
+		}
+
+		regionsByTables[region.Tables] = region
+
+		loc, err := time.LoadLocation(region.Timezone)
+		if err != nil {
+			return fmt.Errorf("region %s has an invalid timezone: %w", region.Tables, err)
+		}
+
+		regionLocations[region.Tables] = loc
+
+		if region.Id < 1 || region.Id > maxRegionId {
+			return fmt.Errorf("region %s id must be between 1 and %d", region.Tables, maxRegionId)
+		}
+
+		if _, ok := regionsById[region.Id]; ok {
+			return fmt.Errorf("region id used more than once: %d", region.Id)
+		}
+
+		regionsById[region.Id] = region
+
+		for _, code := range region.Codes {
+			if _, ok := regionsByCode[code]; ok {
+				return fmt.Errorf("region code used more than once: %q", code)
+			}
+
+			regionsByCode[code] = region
+		}
+
+		if region.Default {
+			if defaultRegion != nil {
+				return errors.New("more than one default region")
+			}
+
+			defaultRegion = region
+		}
+	}
+
+	if defaultRegion == nil {
+		return errors.New("no default region")
+	}
+
+	return nil
+}
+
+// returns the region for a client region code, unknown codes get the default region
+func lookupRegion(code string) *config.Region {
+	region, ok := regionsByCode[code]
+	if !ok {
+		return defaultRegion
+	}
+
+	return region
+}
+
+// like lookupRegion but refuses clients that aren't allowed in a private region
+func getRegion(code, token string) (*config.Region, error) {
+	region := lookupRegion(code)
+	if !region.Private {
+		return region, nil
+	}
+
+	for _, allowed := range region.Tokens {
+		if token == allowed {
+			return region, nil
+		}
+	}
+
+	return nil, fmt.Errorf("token not allowed in private region %s", region.Tables)
+}
+
+func regionLocation(region *config.Region) *time.Location {
+	return regionLocations[region.Tables]
+}
+
+// falls back to the region's language for clients that don't send one
+func clientLang(region *config.Region, lang string) string {
+	if lang == "" {
+		return region.Lang
+	}
+
+	return lang
+}
+
+// the code used to tag games from this region when shown to other regions
+func primaryCode(region *config.Region) string {
+	for _, code := range region.Codes {
+		if code != "" {
+			return code
+		}
+	}
+
+	return region.Tables
+}
+
+// regions whose games are listed to clients in region, their own region first
+func browsableRegions(region *config.Region) []*config.Region {
+	regions := []*config.Region{region}
+	if !conf.SearchOtherCountries || region.Private {
+		return regions
+	}
+
+	for i := range conf.Regions {
+		other := &conf.Regions[i]
+		if other != region && !other.Private {
+			regions = append(regions, other)
+		}
+	}
+
+	return regions
+}
+
+// whether clients in region are shown other's games
+func canBrowse(region, other *config.Region) bool {
+	for _, browsable := range browsableRegions(region)[1:] {
+		if browsable == other {
+			return true
+		}
+	}
+
+	return false
+}
+
+// the sid a client in region sees for game
+func clientSid(region *config.Region, game Game) int {
+	if game.Region == region.Tables {
+		return game.Sid
+	}
+
+	return regionsByTables[game.Region].Id*foreignSidBase + game.Sid
+}
+
+// looks up a game by the sid a client in region sees, which may belong to a region it can browse
+func findGame(region *config.Region, sid int) (Game, *config.Region, error) {
+	if sid >= foreignSidBase {
+		other, ok := regionsById[sid/foreignSidBase]
+		if !ok || !canBrowse(region, other) {
+			return Game{}, nil, ErrNotFound
+		}
+
+		region = other
+		sid %= foreignSidBase
+	}
+
+	game, err := store.Game(region.Tables, sid)
+	if err != nil {
+		return Game{}, nil, err
+	}
+
+	return game, region, nil
+}
+
+// like findGame but games hidden by moderators don't exist
+func findPublicGame(region *config.Region, sid int) (Game, *config.Region, error) {
+	game, gameRegion, err := findGame(region, sid)
+	if err != nil {
+		return Game{}, nil, err
+	}
+
+	if game.Hidden {
+		return Game{}, nil, ErrNotFound
+	}
+
+	return game, gameRegion, nil
+}
+
+// every region's table suffix in config order
+func regionTables() []string {
+	var tables []string
+	for _, region := range conf.Regions {
+		tables = append(tables, region.Tables)
+	}
+
+	return tables
+}
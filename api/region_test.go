@@ -0,0 +1,76 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestFindForeignGame(t *testing.T) {
+	setupTest(t)
+
+	jp, us := regionsByTables["jp"], regionsByTables["us"]
+
+	sid := mustAddGame(t, store, "us", Game{Title: "us game"})
+	foreign := clientSid(jp, Game{Sid: sid, Region: "us"})
+
+	for _, search := range []bool{false, true} {
+		conf.SearchOtherCountries = search
+
+		game, region, err := findGame(jp, foreign)
+		switch {
+		case !search && !errors.Is(err, ErrNotFound):
+			t.Errorf("found a foreign game with cross region browsing off: %v", err)
+		case search && err != nil:
+			t.Errorf("foreign game not found with cross region browsing on: %v", err)
+		case search && (region != us || game.Sid != sid):
+			t.Errorf("got game %d/%s, want %d/us", game.Sid, region.Tables, sid)
+		}
+	}
+
+	// clients never see their own region's games with a region id
+	_, _, err := findGame(us, foreign)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v for a foreign sid from the game's own region, want ErrNotFound", err)
+	}
+}
+
+// the flag clients get follows whether lists are actually merged
+func TestSearchOtherCountriesFlag(t *testing.T) {
+	setupTest(t)
+
+	for _, search := range []bool{false, true} {
+		conf.SearchOtherCountries = search
+
+		rec := clientRequest(t, "/api/flags", []byte(`{"region":"USA","token":"token"}`))
+
+		flagsS := &FlagsS{}
+		err := json.Unmarshal([]byte(decodeUtf16(t, rec.Body.Bytes())), flagsS)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := flag(search)
+		if flagsS.SerchOtherCountries != want {
+			t.Errorf("search %t: got flag %q, want %q", search, flagsS.SerchOtherCountries, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"encoding/binary"
+	"net/http"
+	"unicode/utf16"
+)
+
+// each endpoint decides how its response is sent instead of guessing from the content
+type response interface {
+	send(w http.ResponseWriter) error
+}
+
+// sent as utf-16le like the official server
+type jsonResponse []byte
+
+func (r jsonResponse) send(w http.ResponseWriter) error {
+	respUtf16 := utf16.Encode([]rune(string(r)))
+
+	encoded := make([]byte, len(respUtf16)*2)
+	for i, v := range respUtf16 {
+		binary.LittleEndian.PutUint16(encoded[i*2:i*2+2], v)
+	}
+
+	_, err := w.Write(encoded)
+	return err
+}
+
+// sent as is
+type binaryResponse []byte
+
+func (r binaryResponse) send(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	_, err := w.Write(r)
+	return err
+}
+
+// binary written by the endpoint itself, for data too big to hold in memory
+type streamResponse func(w http.ResponseWriter) error
+
+func (r streamResponse) send(w http.ResponseWriter) error {
+	return r(w)
+}
+
+func asJSON(response []byte, err error) (response, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonResponse(response), nil
+}
@@ -0,0 +1,179 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func clientRequest(t *testing.T, endpoint string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	handleRequest(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: got status %d", endpoint, rec.Code)
+	}
+
+	return rec
+}
+
+func decodeUtf16(t *testing.T, b []byte) string {
+	t.Helper()
+
+	if len(b)%2 != 0 {
+		t.Fatalf("odd length utf-16 response: %q", b)
+	}
+
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+
+	return string(utf16.Decode(units))
+}
+
+func uploadTestGame(t *testing.T, token string, data []byte) {
+	t.Helper()
+
+	meta, err := json.Marshal(RpgUploadC{
+		Title:         base64.StdEncoding.EncodeToString([]byte("test")),
+		Version:       "1",
+		Comment:       base64.StdEncoding.EncodeToString([]byte("test")),
+		Crc32:         int(crc32.ChecksumIEEE(data)),
+		DataBlockSize: len(data),
+		Region:        "USA",
+		Token:         token,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := clientRequest(t, "/api/rpgupload", append(meta, data...))
+
+	rpgUploadS := &RpgUploadS{}
+	err = json.Unmarshal([]byte(decodeUtf16(t, rec.Body.Bytes())), rpgUploadS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rpgUploadS.EndCode != EndCodeSuccess {
+		t.Fatalf("upload failed with end code %d", rpgUploadS.EndCode)
+	}
+}
+
+// game data that's valid utf-8 used to be sent as utf-16 like the json responses
+func TestDownloadIsNotTranscoded(t *testing.T) {
+	setupTest(t)
+
+	for i, data := range [][]byte{
+		[]byte("ASCII looking game data"),
+		[]byte(`{"sid":"1"}`),
+		bytes.Repeat([]byte("MAP EVENT SWITCH "), 1000),
+		{0x00, 0xff, 0xfe, 0x80},
+	} {
+		uploadTestGame(t, "token", data)
+
+		download, err := json.Marshal(RpgDownloadC{Sid: i + 1, Region: "USA", Token: "token"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := clientRequest(t, "/api/rpgdownload", download)
+
+		if !bytes.Equal(rec.Body.Bytes(), data) {
+			t.Errorf("game %d: got %q, want %q", i+1, rec.Body.Bytes(), data)
+		}
+
+		if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(data)) {
+			t.Errorf("game %d: got content length %s, want %d", i+1, got, len(data))
+		}
+	}
+}
+
+func TestJSONIsUtf16(t *testing.T) {
+	setupTest(t)
+
+	rec := clientRequest(t, "/api/flags", []byte(`{"region":"USA","token":"token"}`))
+
+	body := rec.Body.Bytes()
+	if len(body) < 2 || body[0] != '{' || body[1] != 0 {
+		t.Fatalf("response isn't utf-16le: %q", body)
+	}
+
+	flagsS := &FlagsS{}
+	err := json.Unmarshal([]byte(decodeUtf16(t, body)), flagsS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if flagsS.Suid != "1" {
+		t.Errorf("got suid %q, want \"1\"", flagsS.Suid)
+	}
+}
+
+// clients that don't send a region belong to the same region as JPN and get its news
+func TestNewsTargetsRegion(t *testing.T) {
+	setupTest(t)
+
+	id, err := store.AddNews(News{Region: "jp", Body: []byte("jp news"), Publish: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		region string
+		want   int
+	}{
+		{"", id},
+		{"JPN", id},
+		{"USA", -1},
+	} {
+		rec := clientRequest(t, "/api/flags", []byte(`{"region":"`+test.region+`","token":"token"}`))
+
+		flagsS := &FlagsS{}
+		err := json.Unmarshal([]byte(decodeUtf16(t, rec.Body.Bytes())), flagsS)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if flagsS.Flag3 != test.want {
+			t.Errorf("region %q: got news %d, want %d", test.region, flagsS.Flag3, test.want)
+		}
+	}
+
+	rec := clientRequest(t, "/api/news", []byte(`{"region":"","token":"token"}`))
+	if got := rec.Body.String(); got != "jp news" {
+		t.Errorf("got news %q, want \"jp news\"", got)
+	}
+}
@@ -0,0 +1,211 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"refes/config"
+	"sort"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// regions passed to a store are table suffixes (see config.Region) unless noted otherwise
+type Store interface {
+	Contests(region string) ([]Contest, error)
+	Contest(region string, id int) (Contest, error)
+	// sids of a contest's entries ranked by the reviews they got during the review window, best first
+	// entries hidden by moderators aren't ranked
+	ContestRanking(region string, contest Contest) ([]int, error)
+	// sid -> award, every other entry loses its award and the contest is marked as judged
+	SetContestAwards(region string, id int, awards map[int]int) error
+
+	Games(region string, query GameQuery) ([]Game, error)
+	UserGames(suid int) ([]Game, error) // from every region, newest first
+	Game(region string, sid int) (Game, error)
+	AddGame(region string, game Game) (int, error)
+	// updates a game's title, comment, genre and lang
+	EditGame(region string, game Game) error
+	// deletes a game along with its reviews and reports
+	DeleteGame(region string, sid int) error
+	// number of games whose data is the blob with the given hash
+	HashRefs(region, hash string) (int, error)
+	SetHidden(region string, sid int, hidden bool) error
+	AddDownload(region string, sid int) error
+
+	// games taken out of the hall of fame keep their induction date so rules don't put them back
+	SetFamer(region string, sid int, famer bool, now time.Time) error
+	// inducts every visible game that meets the rules and hasn't been inducted before, returns how many were
+	InductFamers(region string, rules config.Famer, now time.Time) (int, error)
+
+	// stores suid's review of a game, replacing their previous one, and recalculates the game's average
+	SetReview(region string, sid, suid, review int) error
+
+	// a repeat report from the same user replaces the previous one
+	AddReport(region string, report Report) error
+	Reports(region string) ([]Report, error) // newest first
+	// dismisses every report against a game
+	ResolveReports(region string, sid int) error
+
+	AddContest(region string, contest Contest) (int, error)
+	EditContest(region string, contest Contest) error
+	DeleteContest(region string, id int) error
+
+	// newest published news post for a region and language
+	NewsId(region, lang string, now time.Time) (int, error)
+	News(region, lang string, now time.Time) ([]byte, error)
+	NewsList() ([]News, error) // newest first
+	AddNews(news News) (int, error)
+	DeleteNews(id int) error
+
+	// looks up the user a console token belongs to, new tokens are given a suid the first time they're seen
+	User(token string) (User, error)
+	UserBySuid(suid int) (User, error)
+	SetBanned(suid int, banned bool) error
+	// renames a user along with every game they've uploaded so uname searches still find them
+	SetUname(suid int, uname string) error
+	// records a sign in and marks the user as seen
+	AddSignIn(suid int, region, lang string, now time.Time) error
+	// number of users that have signed in since the given time
+	ActiveUserCount(since time.Time) (int, error)
+}
+
+// filter | title - uname - suid - password
+// sort | updt - dlcount - reviewave
+// direction | ASC - DESC
+type GameQuery struct {
+	Filter    string
+	Keyword   string
+	Sort      string
+	Direction string
+	Contest   int
+	Award     int // -1 for any
+	Famer     int
+	Count     int
+	Offset    int
+	Hidden    bool // include games hidden by moderators
+}
+
+// name given to users until they register one
+const defaultUname = "reFES User"
+
+var store Store
+
+func newStore() (Store, error) {
+	switch conf.Database.Driver {
+	case "mysql":
+		return newMysqlStore(conf.Database.DSN(), regionTables())
+	case "sqlite":
+		return newSqliteStore(conf.Database.Path, regionTables())
+	case "memory":
+		return newMemoryStore(), nil
+	}
+
+	return nil, fmt.Errorf("unknown database driver: %s", conf.Database.Driver)
+}
+
+var ErrBanned = errors.New("user is banned")
+
+func getUser(token string) (User, error) {
+	if token == "" {
+		return User{}, errors.New("empty token")
+	}
+
+	user, err := store.User(token)
+	if err != nil {
+		return User{}, err
+	}
+
+	if user.Banned {
+		return User{}, ErrBanned
+	}
+
+	return user, nil
+}
+
+// runs query against every region and merges the results as if they came from a single table
+func browseGames(regions []*config.Region, query GameQuery) ([]Game, error) {
+	if len(regions) == 1 {
+		return store.Games(regions[0].Tables, query)
+	}
+
+	// every region has to return enough games to fill the page on its own
+	regionQuery := query
+	regionQuery.Offset = 0
+	if query.Count > 0 {
+		regionQuery.Count = query.Offset + query.Count
+	}
+
+	var games []Game
+	for _, region := range regions {
+		regionGames, err := store.Games(region.Tables, regionQuery)
+		if err != nil {
+			return nil, err
+		}
+
+		games = append(games, regionGames...)
+	}
+
+	sortGames(games, query.Sort, query.Direction)
+
+	if query.Count > 0 {
+		games = paginate(games, query.Offset, query.Count)
+	}
+
+	return games, nil
+}
+
+// sorts games the same way ORDER BY would, ties keep their order
+func sortGames(games []Game, by, direction string) {
+	var less func(a, b Game) bool
+	switch by {
+	case "updt":
+		less = func(a, b Game) bool { return a.Updt.Before(b.Updt) }
+	case "dlcount":
+		less = func(a, b Game) bool { return a.DlCount < b.DlCount }
+	case "reviewave":
+		less = func(a, b Game) bool { return a.ReviewAve < b.ReviewAve }
+	default:
+		return
+	}
+
+	sort.SliceStable(games, func(i, j int) bool {
+		if direction == "DESC" {
+			return less(games[j], games[i])
+		}
+
+		return less(games[i], games[j])
+	})
+}
+
+// applies LIMIT/OFFSET to an already sorted list
+func paginate(games []Game, offset, count int) []Game {
+	if offset >= len(games) {
+		return nil
+	}
+
+	games = games[offset:]
+	if count < len(games) {
+		games = games[:count]
+	}
+
+	return games
+}
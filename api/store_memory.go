@@ -0,0 +1,685 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"log"
+	"refes/config"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryUser struct {
+	User
+	lastseen time.Time
+}
+
+type memoryReview struct {
+	review int
+	updt   time.Time
+}
+
+type memorySignIn struct {
+	suid   int
+	region string
+	lang   string
+	date   time.Time
+}
+
+type reportKey struct {
+	sid  int
+	suid int
+}
+
+// keeps everything in memory and loses it on restart, only meant for tests and trying the server out
+type memoryStore struct {
+	mu sync.Mutex
+
+	contests map[string][]Contest
+	games    map[string]map[int]*Game
+	nextSid  map[string]int
+	reviews  map[string]map[int]map[int]memoryReview // region -> sid -> suid -> review
+	reports  map[string]map[reportKey]Report
+	news     []News
+
+	users   map[string]*memoryUser // by token
+	nextUid int
+	signIns []memorySignIn
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		contests: make(map[string][]Contest),
+		games:    make(map[string]map[int]*Game),
+		nextSid:  make(map[string]int),
+		reviews:  make(map[string]map[int]map[int]memoryReview),
+		reports:  make(map[string]map[reportKey]Report),
+		users:    make(map[string]*memoryUser),
+		nextUid:  1,
+	}
+}
+
+func (s *memoryStore) Contests(region string) ([]Contest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Contest(nil), s.contests[region]...), nil
+}
+
+func (s *memoryStore) Contest(region string, id int) (Contest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.contests[region] {
+		if c.Id == id {
+			return c, nil
+		}
+	}
+
+	return Contest{}, ErrNotFound
+}
+
+func (s *memoryStore) ContestRanking(region string, c Contest) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type score struct {
+		sid     int
+		average float64
+		count   int
+	}
+
+	var scores []score
+	for _, g := range s.sortedGames(region) {
+		if g.Contest != c.Id || g.Hidden {
+			continue
+		}
+
+		var total, count int
+		for _, r := range s.reviews[region][g.Sid] {
+			if !r.updt.Before(c.ReviewStart) && r.updt.Before(c.ReviewEnd) {
+				total += r.review
+				count++
+			}
+		}
+
+		if count > 0 {
+			scores = append(scores, score{g.Sid, float64(total) / float64(count), count})
+		}
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].average != scores[j].average {
+			return scores[i].average > scores[j].average
+		}
+
+		return scores[i].count > scores[j].count
+	})
+
+	var sids []int
+	for _, score := range scores {
+		sids = append(sids, score.sid)
+	}
+
+	return sids, nil
+}
+
+func (s *memoryStore) SetContestAwards(region string, id int, awards map[int]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, g := range s.games[region] {
+		if g.Contest != id {
+			continue
+		}
+
+		g.Award = -1
+		if award, ok := awards[g.Sid]; ok {
+			g.Award = award
+		}
+	}
+
+	for i := range s.contests[region] {
+		if s.contests[region][i].Id == id {
+			s.contests[region][i].Judged = true
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Games(region string, q GameQuery) ([]Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyword := strings.ToLower(q.Keyword)
+
+	var games []Game
+	for _, g := range s.sortedGames(region) {
+		if g.Hidden && !q.Hidden {
+			continue
+		}
+
+		var match bool
+		switch {
+		case q.Filter == "title":
+			match = strings.Contains(strings.ToLower(g.Title), keyword)
+		case q.Filter == "uname":
+			match = strings.Contains(strings.ToLower(g.Uname), keyword)
+		case q.Filter == "suid":
+			match = strings.Contains(strconv.Itoa(g.Suid), keyword)
+		case q.Filter == "password":
+			match = g.Password == q.Keyword
+		case q.Contest != 0:
+			match = g.Contest == q.Contest
+		case q.Award != -1:
+			match = g.Award == q.Award
+		case q.Famer != 0:
+			match = g.Famer == q.Famer
+		default:
+			match = true
+		}
+
+		if match {
+			games = append(games, g)
+		}
+	}
+
+	sortGames(games, q.Sort, q.Direction)
+
+	if q.Count > 0 {
+		games = paginate(games, q.Offset, q.Count)
+	}
+
+	return games, nil
+}
+
+// games in a region in sid order, the caller must hold the lock
+func (s *memoryStore) sortedGames(region string) []Game {
+	var games []Game
+	for _, g := range s.games[region] {
+		games = append(games, *g)
+	}
+
+	sort.Slice(games, func(i, j int) bool { return games[i].Sid < games[j].Sid })
+
+	return games
+}
+
+func (s *memoryStore) UserGames(suid int) ([]Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var regions []string
+	for region := range s.games {
+		regions = append(regions, region)
+	}
+
+	sort.Strings(regions)
+
+	var games []Game
+	for _, region := range regions {
+		for _, g := range s.sortedGames(region) {
+			if g.Suid == suid {
+				games = append(games, g)
+			}
+		}
+	}
+
+	sortGames(games, "updt", "DESC")
+
+	return games, nil
+}
+
+func (s *memoryStore) Game(region string, sid int) (Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[region][sid]
+	if !ok {
+		return Game{}, ErrNotFound
+	}
+
+	return *g, nil
+}
+
+func (s *memoryStore) AddGame(region string, g Game) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.games[region] == nil {
+		s.games[region] = make(map[int]*Game)
+	}
+
+	s.nextSid[region]++
+	g.Sid = s.nextSid[region]
+	g.Region = region
+	s.games[region][g.Sid] = &g
+
+	return g.Sid, nil
+}
+
+func (s *memoryStore) EditGame(region string, game Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[region][game.Sid]
+	if !ok {
+		return ErrNotFound
+	}
+
+	g.Title = game.Title
+	g.Comment = game.Comment
+	g.Genre = game.Genre
+	g.Lang = game.Lang
+
+	return nil
+}
+
+func (s *memoryStore) SetHidden(region string, sid int, hidden bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[region][sid]
+	if !ok {
+		return ErrNotFound
+	}
+
+	g.Hidden = hidden
+
+	return nil
+}
+
+func (s *memoryStore) DeleteGame(region string, sid int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.games[region], sid)
+	delete(s.reviews[region], sid)
+
+	for key := range s.reports[region] {
+		if key.sid == sid {
+			delete(s.reports[region], key)
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) HashRefs(region, hash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int
+	for _, g := range s.games[region] {
+		if g.Hash == hash {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *memoryStore) AddDownload(region string, sid int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g, ok := s.games[region][sid]; ok {
+		g.DlCount++
+	}
+
+	return nil
+}
+
+func (s *memoryStore) SetFamer(region string, sid int, famer bool, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[region][sid]
+	if !ok {
+		return ErrNotFound
+	}
+
+	g.Famer = 0
+	if famer {
+		g.Famer = 1
+		g.FamerDate = now
+	}
+
+	return nil
+}
+
+func (s *memoryStore) InductFamers(region string, rules config.Famer, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var inducted int
+	for _, g := range s.games[region] {
+		if !g.FamerDate.IsZero() || g.Hidden {
+			continue
+		}
+
+		if (rules.DlCount > 0 && g.DlCount >= rules.DlCount) ||
+			(rules.ReviewAve > 0 && g.ReviewAve >= rules.ReviewAve && g.DlCount >= rules.ReviewDlCount) ||
+			(rules.Award > 0 && g.Award >= 0 && g.Award < rules.Award) {
+			g.Famer = 1
+			g.FamerDate = now
+			inducted++
+		}
+	}
+
+	return inducted, nil
+}
+
+func (s *memoryStore) SetReview(region string, sid, suid, review int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reviews[region] == nil {
+		s.reviews[region] = make(map[int]map[int]memoryReview)
+	}
+
+	if s.reviews[region][sid] == nil {
+		s.reviews[region][sid] = make(map[int]memoryReview)
+	}
+
+	s.reviews[region][sid][suid] = memoryReview{review: review, updt: time.Now()}
+
+	if g, ok := s.games[region][sid]; ok {
+		var total int
+		for _, r := range s.reviews[region][sid] {
+			total += r.review
+		}
+
+		g.ReviewAve = float64(total) / float64(len(s.reviews[region][sid]))
+	}
+
+	return nil
+}
+
+func (s *memoryStore) AddReport(region string, r Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reports[region] == nil {
+		s.reports[region] = make(map[reportKey]Report)
+	}
+
+	s.reports[region][reportKey{r.Sid, r.Suid}] = r
+
+	return nil
+}
+
+func (s *memoryStore) Reports(region string) ([]Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reports []Report
+	for _, r := range s.reports[region] {
+		reports = append(reports, r)
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Updt.After(reports[j].Updt) })
+
+	return reports, nil
+}
+
+func (s *memoryStore) ResolveReports(region string, sid int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.reports[region] {
+		if key.sid == sid {
+			delete(s.reports[region], key)
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) AddContest(region string, c Contest) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.Id = 1
+	if contests := s.contests[region]; len(contests) != 0 {
+		c.Id = contests[len(contests)-1].Id + 1
+	}
+
+	s.contests[region] = append(s.contests[region], c)
+
+	return c.Id, nil
+}
+
+func (s *memoryStore) EditContest(region string, c Contest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, contest := range s.contests[region] {
+		if contest.Id == c.Id {
+			c.Judged = contest.Judged
+			s.contests[region][i] = c
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memoryStore) DeleteContest(region string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, contest := range s.contests[region] {
+		if contest.Id == id {
+			s.contests[region] = append(s.contests[region][:i], s.contests[region][i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// the caller must hold the lock
+func (s *memoryStore) currentNews(region, lang string, now time.Time) (News, error) {
+	var current *News
+	for i, n := range s.news {
+		if (n.Region != "" && n.Region != region) || (n.Lang != "" && n.Lang != lang) {
+			continue
+		}
+
+		if n.Publish.After(now) || (!n.Expire.IsZero() && !n.Expire.After(now)) {
+			continue
+		}
+
+		if current == nil || n.Publish.After(current.Publish) || (n.Publish.Equal(current.Publish) && n.Id > current.Id) {
+			current = &s.news[i]
+		}
+	}
+
+	if current == nil {
+		return News{}, ErrNotFound
+	}
+
+	return *current, nil
+}
+
+func (s *memoryStore) NewsId(region, lang string, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, err := s.currentNews(region, lang, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return n.Id, nil
+}
+
+func (s *memoryStore) News(region, lang string, now time.Time) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, err := s.currentNews(region, lang, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.Body, nil
+}
+
+func (s *memoryStore) NewsList() ([]News, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	news := append([]News(nil), s.news...)
+	sort.SliceStable(news, func(i, j int) bool {
+		if !news[i].Publish.Equal(news[j].Publish) {
+			return news[i].Publish.After(news[j].Publish)
+		}
+
+		return news[i].Id > news[j].Id
+	})
+
+	return news, nil
+}
+
+func (s *memoryStore) AddNews(n News) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n.Id = 1
+	if len(s.news) != 0 {
+		n.Id = s.news[len(s.news)-1].Id + 1
+	}
+
+	s.news = append(s.news, n)
+
+	return n.Id, nil
+}
+
+func (s *memoryStore) DeleteNews(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, n := range s.news {
+		if n.Id == id {
+			s.news = append(s.news[:i], s.news[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memoryStore) User(token string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[token]
+	if !ok {
+		u = &memoryUser{User: User{Suid: s.nextUid, Uname: defaultUname}}
+		s.users[token] = u
+		s.nextUid++
+
+		log.Printf("INFO: registered new user %d\n", u.Suid)
+	}
+
+	return u.User, nil
+}
+
+func (s *memoryStore) UserBySuid(suid int) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Suid == suid {
+			return u.User, nil
+		}
+	}
+
+	return User{}, ErrNotFound
+}
+
+func (s *memoryStore) SetBanned(suid int, banned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Suid == suid {
+			u.Banned = banned
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memoryStore) SetUname(suid int, uname string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Suid == suid {
+			u.Uname = uname
+		}
+	}
+
+	for _, games := range s.games {
+		for _, g := range games {
+			if g.Suid == suid {
+				g.Uname = uname
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) AddSignIn(suid int, region, lang string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.signIns = append(s.signIns, memorySignIn{suid, region, lang, now})
+
+	for _, u := range s.users {
+		if u.Suid == suid {
+			u.lastseen = now
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) ActiveUserCount(since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int
+	for _, u := range s.users {
+		if !u.lastseen.Before(since) {
+			count++
+		}
+	}
+
+	return count, nil
+}
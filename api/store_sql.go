@@ -0,0 +1,730 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"refes/config"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+)
+
+// columns are always listed so the schema can grow without breaking scanning
+const (
+	gameColumns    = "sid, suid, title, uname, password, updt, datablocksize, version, packageversion, reviewave, lang, edit, attribute, award, famer, famerdate, comment, contest, owner, genre, dlcount, hidden, hash"
+	contestColumns = "id, name, apply_start, apply_end, review_start, review_end, exc_start, exc_end, judged"
+)
+
+// *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanGame(row scanner) (Game, error) {
+	var g Game
+	var famerDate sql.NullTime
+	err := row.Scan(&g.Sid, &g.Suid, &g.Title, &g.Uname, &g.Password, &g.Updt, &g.DataBlockSize, &g.Version, &g.PackageVersion, &g.ReviewAve, &g.Lang, &g.Edit, &g.Attribute, &g.Award, &g.Famer, &famerDate, &g.Comment, &g.Contest, &g.Owner, &g.Genre, &g.DlCount, &g.Hidden, &g.Hash)
+	if err != nil {
+		return Game{}, err
+	}
+
+	g.FamerDate = famerDate.Time
+
+	return g, nil
+}
+
+func scanContest(row scanner) (Contest, error) {
+	var c Contest
+	err := row.Scan(&c.Id, &c.Name, &c.ApplyStart, &c.ApplyEnd, &c.ReviewStart, &c.ReviewEnd, &c.ExcStart, &c.ExcEnd, &c.Judged)
+	if err != nil {
+		return Contest{}, err
+	}
+
+	return c, nil
+}
+
+// mysql, or sqlite for servers that would rather not run a database
+type sqlStore struct {
+	db      *sql.DB
+	driver  string
+	regions []string
+}
+
+func newMysqlStore(dsn string, regions []string) (*sqlStore, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlStore{db: db, driver: "mysql", regions: regions}, nil
+}
+
+func newSqliteStore(path string, regions []string) (*sqlStore, error) {
+	db := sql.OpenDB(sqliteConnector{"file:" + path + "?_time_format=sqlite&_pragma=busy_timeout(5000)"})
+
+	// sqlite only allows one writer at a time, waiting for the connection is simpler than retrying when it's busy
+	db.SetMaxOpenConns(1)
+
+	return &sqlStore{db: db, driver: "sqlite", regions: regions}, nil
+}
+
+// times are compared as text by sqlite, so they're all stored in UTC like the mysql driver does
+type sqliteConnector struct {
+	dsn string
+}
+
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+}
+
+type utcConn struct {
+	sqliteConn
+}
+
+func (c sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return utcConn{conn.(sqliteConn)}, nil
+}
+
+func (c sqliteConnector) Driver() driver.Driver {
+	return &sqlite.Driver{}
+}
+
+func (c utcConn) CheckNamedValue(v *driver.NamedValue) error {
+	value, err := driver.DefaultParameterConverter.ConvertValue(v.Value)
+	if err != nil {
+		return err
+	}
+
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC()
+	}
+
+	v.Value = value
+
+	return nil
+}
+
+// matches values containing the parameter
+func (s *sqlStore) contains() string {
+	if s.driver == "sqlite" {
+		return "LIKE '%' || ? || '%'"
+	}
+
+	return "LIKE CONCAT('%', ?, '%')"
+}
+
+// inserts a row unless it would duplicate a unique key
+func (s *sqlStore) insertIgnore() string {
+	if s.driver == "sqlite" {
+		return "INSERT OR IGNORE"
+	}
+
+	return "INSERT IGNORE"
+}
+
+// replaces columns of the existing row when an insert would duplicate key
+func (s *sqlStore) upsert(key string, columns ...string) string {
+	var set []string
+	for _, column := range columns {
+		if s.driver == "sqlite" {
+			set = append(set, column+" = excluded."+column)
+		} else {
+			set = append(set, column+" = VALUES("+column+")")
+		}
+	}
+
+	if s.driver == "sqlite" {
+		return "ON CONFLICT (" + key + ") DO UPDATE SET " + strings.Join(set, ", ")
+	}
+
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+}
+
+// turns sql.ErrNoRows into ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (s *sqlStore) Contests(region string) ([]Contest, error) {
+	results, err := s.db.Query("SELECT " + contestColumns + " FROM contests_" + region)
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	var contests []Contest
+	for results.Next() {
+		c, err := scanContest(results)
+		if err != nil {
+			return nil, err
+		}
+
+		contests = append(contests, c)
+	}
+
+	return contests, results.Err()
+}
+
+func (s *sqlStore) Contest(region string, id int) (Contest, error) {
+	c, err := scanContest(s.db.QueryRow("SELECT "+contestColumns+" FROM contests_"+region+" WHERE id = ?", id))
+	if err != nil {
+		return Contest{}, notFound(err)
+	}
+
+	return c, nil
+}
+
+func (s *sqlStore) ContestRanking(region string, c Contest) ([]int, error) {
+	results, err := s.db.Query("SELECT g.sid FROM games_"+region+" g JOIN reviews_"+region+" r ON r.sid = g.sid WHERE g.contest = ? AND g.hidden = 0 AND r.updt >= ? AND r.updt < ? GROUP BY g.sid ORDER BY AVG(r.review) DESC, COUNT(*) DESC, g.sid ASC",
+		c.Id, c.ReviewStart, c.ReviewEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	var sids []int
+	for results.Next() {
+		var sid int
+		err := results.Scan(&sid)
+		if err != nil {
+			return nil, err
+		}
+
+		sids = append(sids, sid)
+	}
+
+	return sids, results.Err()
+}
+
+func (s *sqlStore) SetContestAwards(region string, id int, awards map[int]int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE games_"+region+" SET award = -1 WHERE contest = ?", id)
+	if err != nil {
+		return err
+	}
+
+	for sid, award := range awards {
+		_, err = tx.Exec("UPDATE games_"+region+" SET award = ? WHERE sid = ? AND contest = ?", award, sid, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE contests_"+region+" SET judged = 1 WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) Games(region string, q GameQuery) ([]Game, error) {
+	var where []string
+	var params []any
+
+	query := "SELECT " + gameColumns + " FROM games_" + region
+
+	switch {
+	case q.Filter != "":
+		if q.Filter == "password" {
+			where = append(where, q.Filter+" = ?") // do not use wildcard for password filter
+		} else {
+			where = append(where, q.Filter+" "+s.contains())
+		}
+
+		params = append(params, q.Keyword)
+	case q.Contest != 0:
+		where = append(where, "contest = ?")
+		params = append(params, q.Contest)
+	case q.Award != -1:
+		where = append(where, "award = ?")
+		params = append(params, q.Award)
+	case q.Famer != 0:
+		where = append(where, "famer = ?")
+		params = append(params, q.Famer)
+	}
+
+	if !q.Hidden {
+		where = append(where, "hidden = 0")
+	}
+
+	if len(where) != 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	if q.Sort != "" {
+		query += " ORDER BY " + q.Sort + " " + q.Direction
+	}
+
+	if q.Count > 0 {
+		query += " LIMIT ?"
+		params = append(params, q.Count)
+
+		if q.Offset > 0 { // nested because OFFSET without LIMIT is pointless
+			query += " OFFSET ?"
+			params = append(params, q.Offset)
+		}
+	}
+
+	return s.queryGames(region, query, params...)
+}
+
+func (s *sqlStore) UserGames(suid int) ([]Game, error) {
+	var games []Game
+	for _, region := range s.regions {
+		regionGames, err := s.queryGames(region, "SELECT "+gameColumns+" FROM games_"+region+" WHERE suid = ?", suid)
+		if err != nil {
+			return nil, err
+		}
+
+		games = append(games, regionGames...)
+	}
+
+	sortGames(games, "updt", "DESC")
+
+	return games, nil
+}
+
+func (s *sqlStore) Game(region string, sid int) (Game, error) {
+	g, err := scanGame(s.db.QueryRow("SELECT "+gameColumns+" FROM games_"+region+" WHERE sid = ?", sid))
+	if err != nil {
+		return Game{}, notFound(err)
+	}
+
+	g.Region = region
+
+	return g, nil
+}
+
+func (s *sqlStore) queryGames(region, query string, params ...any) ([]Game, error) {
+	results, err := s.db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	var games []Game
+	for results.Next() {
+		g, err := scanGame(results)
+		if err != nil {
+			return nil, err
+		}
+
+		g.Region = region
+
+		games = append(games, g)
+	}
+
+	return games, results.Err()
+}
+
+func (s *sqlStore) AddGame(region string, g Game) (int, error) {
+	result, err := s.db.Exec("INSERT INTO games_"+region+" (suid, title, uname, password, updt, datablocksize, version, packageversion, reviewave, lang, edit, attribute, award, famer, comment, contest, owner, genre, dlcount, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		g.Suid, g.Title, g.Uname, g.Password, g.Updt, g.DataBlockSize, g.Version, g.PackageVersion, g.ReviewAve, g.Lang, g.Edit, g.Attribute, g.Award, g.Famer, g.Comment, g.Contest, g.Owner, g.Genre, g.DlCount, g.Hash)
+	if err != nil {
+		return 0, err
+	}
+
+	sid, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(sid), nil
+}
+
+func (s *sqlStore) EditGame(region string, g Game) error {
+	return s.execOne("UPDATE games_"+region+" SET title = ?, comment = ?, genre = ?, lang = ? WHERE sid = ?", g.Title, g.Comment, g.Genre, g.Lang, g.Sid)
+}
+
+func (s *sqlStore) SetHidden(region string, sid int, hidden bool) error {
+	return s.execOne("UPDATE games_"+region+" SET hidden = ? WHERE sid = ?", hidden, sid)
+}
+
+// runs an update that should match exactly one row, ErrNotFound if it matched none
+func (s *sqlStore) execOne(query string, params ...any) error {
+	result, err := s.db.Exec(query, params...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlStore) DeleteGame(region string, sid int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, table := range []string{"games_", "reviews_", "reports_"} {
+		_, err = tx.Exec("DELETE FROM "+table+region+" WHERE sid = ?", sid)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) HashRefs(region, hash string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM games_"+region+" WHERE hash = ?", hash).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *sqlStore) AddDownload(region string, sid int) error {
+	_, err := s.db.Exec("UPDATE games_"+region+" SET dlcount = dlcount + 1 WHERE sid = ?", sid)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqlStore) SetFamer(region string, sid int, famer bool, now time.Time) error {
+	if famer {
+		return s.execOne("UPDATE games_"+region+" SET famer = 1, famerdate = ? WHERE sid = ?", now, sid)
+	}
+
+	return s.execOne("UPDATE games_"+region+" SET famer = 0 WHERE sid = ?", sid)
+}
+
+func (s *sqlStore) InductFamers(region string, rules config.Famer, now time.Time) (int, error) {
+	var conditions []string
+	params := []any{now}
+
+	if rules.DlCount > 0 {
+		conditions = append(conditions, "dlcount >= ?")
+		params = append(params, rules.DlCount)
+	}
+
+	if rules.ReviewAve > 0 {
+		conditions = append(conditions, "(reviewave >= ? AND dlcount >= ?)")
+		params = append(params, rules.ReviewAve, rules.ReviewDlCount)
+	}
+
+	if rules.Award > 0 {
+		conditions = append(conditions, "(award >= 0 AND award < ?)")
+		params = append(params, rules.Award)
+	}
+
+	if len(conditions) == 0 {
+		return 0, nil
+	}
+
+	result, err := s.db.Exec("UPDATE games_"+region+" SET famer = 1, famerdate = ? WHERE famerdate IS NULL AND hidden = 0 AND ("+strings.Join(conditions, " OR ")+")", params...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(affected), nil
+}
+
+func (s *sqlStore) SetReview(region string, sid, suid, review int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO reviews_"+region+" (sid, suid, review, updt) VALUES (?, ?, ?, ?) "+s.upsert("sid, suid", "review", "updt"), sid, suid, review, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE games_"+region+" SET reviewave = (SELECT AVG(review) FROM reviews_"+region+" WHERE sid = ?) WHERE sid = ?", sid, sid)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) AddReport(region string, r Report) error {
+	_, err := s.db.Exec("INSERT INTO reports_"+region+" (sid, suid, info1, info2, info3, info4, info5, info6, text, updt) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) "+s.upsert("sid, suid", "info1", "info2", "info3", "info4", "info5", "info6", "text", "updt"),
+		r.Sid, r.Suid, r.Info[0], r.Info[1], r.Info[2], r.Info[3], r.Info[4], r.Info[5], r.Text, r.Updt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqlStore) Reports(region string) ([]Report, error) {
+	results, err := s.db.Query("SELECT sid, suid, info1, info2, info3, info4, info5, info6, text, updt FROM reports_" + region + " ORDER BY updt DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	var reports []Report
+	for results.Next() {
+		var r Report
+		err := results.Scan(&r.Sid, &r.Suid, &r.Info[0], &r.Info[1], &r.Info[2], &r.Info[3], &r.Info[4], &r.Info[5], &r.Text, &r.Updt)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, r)
+	}
+
+	return reports, results.Err()
+}
+
+func (s *sqlStore) ResolveReports(region string, sid int) error {
+	_, err := s.db.Exec("DELETE FROM reports_"+region+" WHERE sid = ?", sid)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqlStore) AddContest(region string, c Contest) (int, error) {
+	result, err := s.db.Exec("INSERT INTO contests_"+region+" (name, apply_start, apply_end, review_start, review_end, exc_start, exc_end) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		c.Name, c.ApplyStart, c.ApplyEnd, c.ReviewStart, c.ReviewEnd, c.ExcStart, c.ExcEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *sqlStore) EditContest(region string, c Contest) error {
+	return s.execOne("UPDATE contests_"+region+" SET name = ?, apply_start = ?, apply_end = ?, review_start = ?, review_end = ?, exc_start = ?, exc_end = ? WHERE id = ?",
+		c.Name, c.ApplyStart, c.ApplyEnd, c.ReviewStart, c.ReviewEnd, c.ExcStart, c.ExcEnd, c.Id)
+}
+
+func (s *sqlStore) DeleteContest(region string, id int) error {
+	return s.execOne("DELETE FROM contests_"+region+" WHERE id = ?", id)
+}
+
+// an empty region or lang targets everyone
+const newsQuery = "FROM news WHERE (region = '' OR region = ?) AND (lang = '' OR lang = ?) AND publish <= ? AND (expire IS NULL OR expire > ?) ORDER BY publish DESC, id DESC LIMIT 1"
+
+func (s *sqlStore) NewsId(region, lang string, now time.Time) (int, error) {
+	var id int
+	err := s.db.QueryRow("SELECT id "+newsQuery, region, lang, now, now).Scan(&id)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	return id, nil
+}
+
+func (s *sqlStore) News(region, lang string, now time.Time) ([]byte, error) {
+	var body []byte
+	err := s.db.QueryRow("SELECT body "+newsQuery, region, lang, now, now).Scan(&body)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return body, nil
+}
+
+func (s *sqlStore) NewsList() ([]News, error) {
+	results, err := s.db.Query("SELECT id, region, lang, body, publish, expire FROM news ORDER BY publish DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	var news []News
+	for results.Next() {
+		var n News
+		var expire sql.NullTime
+		err := results.Scan(&n.Id, &n.Region, &n.Lang, &n.Body, &n.Publish, &expire)
+		if err != nil {
+			return nil, err
+		}
+
+		n.Expire = expire.Time
+		news = append(news, n)
+	}
+
+	return news, results.Err()
+}
+
+func (s *sqlStore) AddNews(n News) (int, error) {
+	expire := sql.NullTime{Time: n.Expire, Valid: !n.Expire.IsZero()}
+	result, err := s.db.Exec("INSERT INTO news (region, lang, body, publish, expire) VALUES (?, ?, ?, ?, ?)", n.Region, n.Lang, n.Body, n.Publish, expire)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *sqlStore) DeleteNews(id int) error {
+	return s.execOne("DELETE FROM news WHERE id = ?", id)
+}
+
+func (s *sqlStore) User(token string) (User, error) {
+	var u User
+	err := s.db.QueryRow("SELECT suid, uname, banned FROM users WHERE token = ?", token).Scan(&u.Suid, &u.Uname, &u.Banned)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return u, err
+	}
+
+	// ignore duplicates in case another request registered the token first
+	_, err = s.db.Exec(s.insertIgnore()+" INTO users (token, uname, created) VALUES (?, ?, ?)", token, defaultUname, time.Now())
+	if err != nil {
+		return User{}, err
+	}
+
+	err = s.db.QueryRow("SELECT suid, uname, banned FROM users WHERE token = ?", token).Scan(&u.Suid, &u.Uname, &u.Banned)
+	if err != nil {
+		return User{}, err
+	}
+
+	log.Printf("INFO: registered new user %d\n", u.Suid)
+
+	return u, nil
+}
+
+func (s *sqlStore) UserBySuid(suid int) (User, error) {
+	var u User
+	err := s.db.QueryRow("SELECT suid, uname, banned FROM users WHERE suid = ?", suid).Scan(&u.Suid, &u.Uname, &u.Banned)
+	if err != nil {
+		return User{}, notFound(err)
+	}
+
+	return u, nil
+}
+
+func (s *sqlStore) SetBanned(suid int, banned bool) error {
+	return s.execOne("UPDATE users SET banned = ? WHERE suid = ?", banned, suid)
+}
+
+func (s *sqlStore) SetUname(suid int, uname string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	tables := []string{"users"}
+	for _, region := range s.regions {
+		tables = append(tables, "games_"+region)
+	}
+
+	for _, table := range tables {
+		_, err = tx.Exec("UPDATE "+table+" SET uname = ? WHERE suid = ?", uname, suid)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) AddSignIn(suid int, region, lang string, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO signins (suid, region, lang, date) VALUES (?, ?, ?, ?)", suid, region, lang, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE users SET lastseen = ? WHERE suid = ?", now, suid)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) ActiveUserCount(since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE lastseen >= ?", since).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,670 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"refes/config"
+	"testing"
+	"time"
+)
+
+var testStoreRegions = []string{"jp", "us"}
+
+// runs a test against every store, mysql is skipped unless REFES_TEST_MYSQL_DSN is set
+// to a database that can be wiped, using the parameters config.Database.DSN adds
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryStore())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		s, err := newSqliteStore(filepath.Join(t.TempDir(), "refes.db"), testStoreRegions)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		migrateTestStore(t, s)
+		test(t, s)
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		dsn := os.Getenv("REFES_TEST_MYSQL_DSN")
+		if dsn == "" {
+			t.Skip("REFES_TEST_MYSQL_DSN isn't set")
+		}
+
+		s, err := newMysqlStore(dsn, testStoreRegions)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// start from an empty database, sids and suids included
+		tables := []string{"schema_migrations", "users", "signins", "news"}
+		for _, region := range testStoreRegions {
+			tables = append(tables, "games_"+region, "contests_"+region, "reviews_"+region, "reports_"+region)
+		}
+
+		for _, table := range tables {
+			_, err = s.db.Exec("DROP TABLE IF EXISTS " + table)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		migrateTestStore(t, s)
+		test(t, s)
+	})
+}
+
+func migrateTestStore(t *testing.T, s *sqlStore) {
+	t.Helper()
+
+	t.Cleanup(func() { s.db.Close() })
+
+	err := s.migrate("up")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// a zero award is taken as no award, which the store keeps as -1
+func mustAddGame(t *testing.T, s Store, region string, g Game) int {
+	t.Helper()
+
+	if g.Award == 0 {
+		g.Award = -1
+	}
+
+	sid, err := s.AddGame(region, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sid
+}
+
+func sids(games []Game) []int {
+	var sids []int
+	for _, g := range games {
+		sids = append(sids, g.Sid)
+	}
+
+	return sids
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestStoreUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		first, err := s.User("token1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		again, err := s.User("token1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		other, err := s.User("token2")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if first.Suid != again.Suid {
+			t.Errorf("same token got suids %d and %d", first.Suid, again.Suid)
+		}
+
+		if first.Suid == other.Suid {
+			t.Errorf("different tokens got the same suid %d", first.Suid)
+		}
+
+		if first.Uname != defaultUname {
+			t.Errorf("got uname %q, want %q", first.Uname, defaultUname)
+		}
+
+		sid := mustAddGame(t, s, "jp", Game{Suid: first.Suid, Uname: first.Uname, Title: "game"})
+
+		err = s.SetUname(first.Suid, "Renamed")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		game, err := s.Game("jp", sid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if game.Uname != "Renamed" {
+			t.Errorf("game uname wasn't updated: %q", game.Uname)
+		}
+
+		err = s.SetBanned(first.Suid, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := s.UserBySuid(first.Suid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !user.Banned || user.Uname != "Renamed" {
+			t.Errorf("got %+v, want banned and renamed", user)
+		}
+
+		_, err = s.UserBySuid(1000)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("unknown suid: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreGames(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		a := mustAddGame(t, s, "jp", Game{Suid: 1, Uname: "Alice", Title: "Dragon Quest", Password: "AAAA", DlCount: 5})
+		b := mustAddGame(t, s, "jp", Game{Suid: 2, Uname: "Bob", Title: "Slime Hunt", Password: "BBBB", DlCount: 10})
+		c := mustAddGame(t, s, "jp", Game{Suid: 1, Uname: "Alice", Title: "dragon tale", Password: "CCCC", DlCount: 1, Award: 2})
+		hidden := mustAddGame(t, s, "jp", Game{Suid: 3, Uname: "Eve", Title: "Dragon Spam", Password: "DDDD", DlCount: 100})
+		mustAddGame(t, s, "us", Game{Suid: 1, Uname: "Alice", Title: "Dragon Quest US"})
+
+		err := s.SetHidden("jp", hidden, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name  string
+			query GameQuery
+			want  []int
+		}{
+			{"title", GameQuery{Filter: "title", Keyword: "dragon", Sort: "dlcount", Direction: "DESC", Award: -1}, []int{a, c}},
+			{"uname", GameQuery{Filter: "uname", Keyword: "bob", Award: -1}, []int{b}},
+			{"suid", GameQuery{Filter: "suid", Keyword: "1", Sort: "dlcount", Direction: "ASC", Award: -1}, []int{c, a}},
+			{"password", GameQuery{Filter: "password", Keyword: "BBBB", Award: -1}, []int{b}},
+			{"award", GameQuery{Award: 2}, []int{c}},
+			{"hidden included", GameQuery{Filter: "title", Keyword: "dragon", Sort: "dlcount", Direction: "DESC", Award: -1, Hidden: true}, []int{hidden, a, c}},
+			{"first page", GameQuery{Sort: "dlcount", Direction: "DESC", Award: -1, Count: 2}, []int{b, a}},
+			{"second page", GameQuery{Sort: "dlcount", Direction: "DESC", Award: -1, Count: 2, Offset: 2}, []int{c}},
+			{"past the end", GameQuery{Award: -1, Count: 2, Offset: 10}, nil},
+		}
+
+		for _, test := range tests {
+			games, err := s.Games("jp", test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sids(games); !equalInts(got, test.want) {
+				t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+			}
+		}
+
+		games, err := s.UserGames(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(games) != 3 {
+			t.Errorf("got %d games for user 1 across regions, want 3", len(games))
+		}
+
+		err = s.DeleteGame("jp", a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.Game("jp", a)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleted game: got %v, want ErrNotFound", err)
+		}
+
+		err = s.SetHidden("jp", a, true)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("hiding a deleted game: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// reviews can't be read back through Store, so this looks at each store's own tables
+func storedReviews(t *testing.T, s Store, region string, sid int) int {
+	t.Helper()
+
+	switch s := s.(type) {
+	case *memoryStore:
+		return len(s.reviews[region][sid])
+	case *sqlStore:
+		var count int
+		err := s.db.QueryRow("SELECT COUNT(*) FROM reviews_"+region+" WHERE sid = ?", sid).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return count
+	}
+
+	t.Fatalf("unknown store %T", s)
+
+	return 0
+}
+
+func TestStoreDeleteGame(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		deleted := mustAddGame(t, s, "jp", Game{})
+		kept := mustAddGame(t, s, "jp", Game{})
+
+		for _, sid := range []int{deleted, kept} {
+			err := s.SetReview("jp", sid, 1, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.AddReport("jp", Report{Sid: sid, Suid: 1, Updt: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := s.DeleteGame("jp", deleted)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reports, err := s.Reports("jp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(reports) != 1 || reports[0].Sid != kept {
+			t.Errorf("got reports %+v, want only game %d's", reports, kept)
+		}
+
+		if n := storedReviews(t, s, "jp", deleted); n != 0 {
+			t.Errorf("deleted game still has %d reviews", n)
+		}
+
+		if n := storedReviews(t, s, "jp", kept); n != 1 {
+			t.Errorf("kept game has %d reviews, want 1", n)
+		}
+	})
+}
+
+func TestStoreHashRefs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		mustAddGame(t, s, "jp", Game{Hash: "a"})
+		sid := mustAddGame(t, s, "jp", Game{Hash: "a"})
+		mustAddGame(t, s, "jp", Game{Hash: "b"})
+
+		refs, err := s.HashRefs("jp", "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if refs != 2 {
+			t.Errorf("got %d refs, want 2", refs)
+		}
+
+		err = s.DeleteGame("jp", sid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		refs, err = s.HashRefs("jp", "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if refs != 1 {
+			t.Errorf("got %d refs after delete, want 1", refs)
+		}
+	})
+}
+
+func TestStoreReviews(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		sid := mustAddGame(t, s, "jp", Game{Title: "game"})
+
+		for _, review := range []struct{ suid, review int }{{1, 5}, {2, 2}, {1, 3}} {
+			err := s.SetReview("jp", sid, review.suid, review.review)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		game, err := s.Game("jp", sid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// user 1's second review replaces their first
+		if game.ReviewAve != 2.5 {
+			t.Errorf("got review average %f, want 2.5", game.ReviewAve)
+		}
+	})
+}
+
+func TestStoreReports(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		now := time.Now()
+
+		for _, report := range []Report{
+			{Sid: 1, Suid: 1, Info: [6]int{1}, Text: "first", Updt: now},
+			{Sid: 1, Suid: 1, Info: [6]int{0, 1}, Text: "again", Updt: now.Add(time.Second)},
+			{Sid: 1, Suid: 2, Text: "other user", Updt: now.Add(2 * time.Second)},
+			{Sid: 2, Suid: 1, Text: "other game", Updt: now.Add(3 * time.Second)},
+		} {
+			err := s.AddReport("jp", report)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		reports, err := s.Reports("jp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var texts []string
+		for _, report := range reports {
+			texts = append(texts, report.Text)
+		}
+
+		want := []string{"other game", "other user", "again"}
+		if len(texts) != len(want) || texts[0] != want[0] || texts[1] != want[1] || texts[2] != want[2] {
+			t.Errorf("got reports %q, want %q", texts, want)
+		}
+
+		err = s.ResolveReports("jp", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reports, err = s.Reports("jp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(reports) != 1 || reports[0].Sid != 2 {
+			t.Errorf("got %+v after resolving game 1, want only game 2's report", reports)
+		}
+	})
+}
+
+func TestStoreContestJudging(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		now := time.Now()
+		contest := Contest{
+			Name:        "test",
+			ApplyStart:  now.Add(-3 * time.Hour),
+			ApplyEnd:    now.Add(-2 * time.Hour),
+			ReviewStart: now.Add(-time.Hour),
+			ReviewEnd:   now.Add(time.Hour),
+			ExcStart:    now.Add(2 * time.Hour),
+			ExcEnd:      now.Add(3 * time.Hour),
+		}
+
+		id, err := s.AddContest("jp", contest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contest.Id = id
+
+		low := mustAddGame(t, s, "jp", Game{Contest: id})
+		high := mustAddGame(t, s, "jp", Game{Contest: id})
+		popular := mustAddGame(t, s, "jp", Game{Contest: id})
+		unreviewed := mustAddGame(t, s, "jp", Game{Contest: id})
+		hidden := mustAddGame(t, s, "jp", Game{Contest: id})
+		mustAddGame(t, s, "jp", Game{})
+
+		for _, review := range []struct{ sid, suid, review int }{
+			{low, 1, 2},
+			{high, 1, 5},
+			{popular, 1, 5},
+			{popular, 2, 5},
+			{hidden, 1, 5},
+			{hidden, 2, 5},
+			{hidden, 3, 5},
+		} {
+			err := s.SetReview("jp", review.sid, review.suid, review.review)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = s.SetHidden("jp", hidden, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ranking, err := s.ContestRanking("jp", contest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// ties go to the entry with more reviews, hidden entries can't win
+		if want := []int{popular, high, low}; !equalInts(ranking, want) {
+			t.Errorf("got ranking %v, want %v", ranking, want)
+		}
+
+		err = s.SetContestAwards("jp", id, map[int]int{popular: 0, high: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for sid, want := range map[int]int{popular: 0, high: 1, low: -1, unreviewed: -1, hidden: -1} {
+			game, err := s.Game("jp", sid)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if game.Award != want {
+				t.Errorf("game %d: got award %d, want %d", sid, game.Award, want)
+			}
+		}
+
+		contest, err = s.Contest("jp", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !contest.Judged {
+			t.Error("contest wasn't marked as judged")
+		}
+	})
+}
+
+func TestStoreFamers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		downloaded := mustAddGame(t, s, "jp", Game{DlCount: 100})
+		reviewed := mustAddGame(t, s, "jp", Game{DlCount: 20})
+		awarded := mustAddGame(t, s, "jp", Game{Award: 1})
+		hidden := mustAddGame(t, s, "jp", Game{DlCount: 1000})
+		mustAddGame(t, s, "jp", Game{DlCount: 5})
+
+		err := s.SetReview("jp", reviewed, 1, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.SetHidden("jp", hidden, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rules := config.Famer{DlCount: 100, ReviewAve: 4.5, ReviewDlCount: 10, Award: 2}
+		now := time.Now()
+
+		inducted, err := s.InductFamers("jp", rules, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inducted != 3 {
+			t.Errorf("got %d inducted, want 3", inducted)
+		}
+
+		famers, err := s.Games("jp", GameQuery{Famer: 1, Award: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(famers) != 3 {
+			t.Errorf("got famers %v, want %v", sids(famers), []int{downloaded, reviewed, awarded})
+		}
+
+		// taken out by hand, the rules mustn't put it back
+		err = s.SetFamer("jp", downloaded, false, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inducted, err = s.InductFamers("jp", rules, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inducted != 0 {
+			t.Errorf("got %d inducted the second time, want 0", inducted)
+		}
+	})
+}
+
+func TestStoreNews(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		now := time.Now()
+
+		add := func(n News) int {
+			id, err := s.AddNews(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return id
+		}
+
+		everyone := add(News{Body: []byte("everyone"), Publish: now.Add(-2 * time.Hour)})
+		japanese := add(News{Lang: "ja", Body: []byte("ja"), Publish: now.Add(-time.Hour)})
+		european := add(News{Region: "eu", Body: []byte("eu"), Publish: now.Add(-time.Hour)})
+		add(News{Body: []byte("expired"), Publish: now.Add(-time.Minute), Expire: now.Add(-time.Second)})
+		add(News{Body: []byte("scheduled"), Publish: now.Add(time.Hour)})
+
+		tests := []struct {
+			region, lang string
+			want         int
+		}{
+			{"jp", "ja", japanese},
+			{"us", "en", everyone},
+			{"eu", "en", european},
+		}
+
+		for _, test := range tests {
+			id, err := s.NewsId(test.region, test.lang, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if id != test.want {
+				t.Errorf("%s/%s: got news %d, want %d", test.region, test.lang, id, test.want)
+			}
+		}
+
+		err := s.DeleteNews(everyone)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.NewsId("us", "en", now)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v with no current news, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreActiveUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		now := time.Now()
+
+		for i, token := range []string{"a", "b", "c"} {
+			user, err := s.User(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.AddSignIn(user.Suid, "JPN", "ja", now.Add(-time.Duration(i)*time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		count, err := s.ActiveUserCount(now.Add(-90 * time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != 2 {
+			t.Errorf("got %d active users, want 2", count)
+		}
+	})
+}
+
+// pages are taken from every region's games ranked together
+func TestBrowseGames(t *testing.T) {
+	setupTest(t)
+
+	jp, us := regionsByTables["jp"], regionsByTables["us"]
+
+	for _, g := range []struct {
+		region  string
+		dlcount int
+	}{{"jp", 5}, {"us", 4}, {"jp", 3}, {"us", 2}, {"jp", 1}} {
+		mustAddGame(t, store, g.region, Game{DlCount: g.dlcount})
+	}
+
+	var got []int
+	for offset := 0; offset < 6; offset += 2 {
+		games, err := browseGames([]*config.Region{jp, us}, GameQuery{Sort: "dlcount", Direction: "DESC", Award: -1, Count: 2, Offset: offset})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, g := range games {
+			got = append(got, g.DlCount)
+		}
+	}
+
+	if want := []int{5, 4, 3, 2, 1}; !equalInts(got, want) {
+		t.Errorf("got dlcounts %v, want %v", got, want)
+	}
+}
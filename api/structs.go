@@ -18,7 +18,23 @@
 
 package api
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// non-zero endcodes are reported to the player as a failure
+const (
+	EndCodeSuccess = iota
+	EndCodeNotFound
+	EndCodeNotOwner
+	EndCodeInvalid
+	EndCodeUnameLength
+	EndCodeUnameChars
+	EndCodeUnameNg
+	EndCodeContestClosed
+)
 
 type GenericC struct {
 	Region string `json:"region"`
@@ -123,6 +139,7 @@ type RpgListEntry struct {
 	Contest        string `json:"contest"`
 	Owner          string `json:"owner"`
 	DlCount        string `json:"dlcount"`
+	Region         string `json:"region,omitempty"` // only set for games from other regions
 
 	Genre1  string `json:"genre1,omitempty"`  // Fantasy
 	Genre2  string `json:"genre2,omitempty"`  // SF
@@ -237,6 +254,7 @@ type RpgUploadC struct {
 	Owner          int    `json:"owner"`
 	Crc32          int    `json:"crc32"`
 	DataBlockSize  int    `json:"datablocksize"`
+	Contest        int    `json:"contest"` // only sent for contest entries
 	Region         string `json:"region"`
 	Token          string `json:"token"`
 
@@ -286,6 +304,18 @@ type RpgDeleteC struct {
 }
 type RpgDeleteS GenericS
 
+// returns the selected genres in the format they're stored in
+func (c RpgUploadC) genres() string {
+	var genres []string
+	for i, genre := range []string{c.Genre1, c.Genre2, c.Genre3, c.Genre4, c.Genre5, c.Genre6, c.Genre7, c.Genre8, c.Genre9, c.Genre10, c.Genre11, c.Genre12, c.Genre13, c.Genre14, c.Genre15, c.Genre16, c.Genre17, c.Genre18, c.Genre19, c.Genre20, c.Genre21, c.Genre22, c.Genre23, c.Genre24, c.Genre25, c.Genre26, c.Genre27, c.Genre28, c.Genre29, c.Genre30, c.Genre31, c.Genre32, c.Genre33, c.Genre34} {
+		if genre == "1" {
+			genres = append(genres, strconv.Itoa(i+1))
+		}
+	}
+
+	return strings.Join(genres, ",")
+}
+
 // json marshalers
 func (l RpgListS) MarshalJSON() ([]byte, error) {
 	tmp := make(map[string]any)
@@ -298,3 +328,7 @@ func (l RpgListS) MarshalJSON() ([]byte, error) {
 
 	return json.Marshal(tmp)
 }
+
+func (l MyRpgListS) MarshalJSON() ([]byte, error) {
+	return RpgListS(l).MarshalJSON()
+}
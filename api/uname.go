@@ -0,0 +1,86 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxUnameLength = 10 // same as the console's own user names
+
+// words that aren't allowed anywhere in a user name, compared case insensitively
+var ngWords []string
+
+// reads one word per line, blank lines and lines starting with # are ignored
+func loadNgWords(path string) error {
+	file, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("WARN: %s not found, user names will not be filtered\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ngWords = nil
+	for _, line := range strings.Split(string(file), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		ngWords = append(ngWords, strings.ToLower(line))
+	}
+
+	log.Printf("INFO: loaded %d ng words\n", len(ngWords))
+
+	return nil
+}
+
+// returns the endcode to respond with for the given user name
+func validateUname(uname string) int {
+	length := utf8.RuneCountInString(uname)
+	if length == 0 || length > maxUnameLength {
+		return EndCodeUnameLength
+	}
+
+	if !utf8.ValidString(uname) || strings.TrimSpace(uname) != uname {
+		return EndCodeUnameChars
+	}
+
+	for _, r := range uname {
+		if !unicode.IsPrint(r) {
+			return EndCodeUnameChars
+		}
+	}
+
+	lower := strings.ToLower(uname)
+	for _, word := range ngWords {
+		if strings.Contains(lower, word) {
+			return EndCodeUnameNg
+		}
+	}
+
+	return EndCodeSuccess
+}
@@ -0,0 +1,69 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"refes/config"
+	"strings"
+)
+
+const passwordChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // no lookalikes
+
+// where games were stored before the blob store
+func gamePath(sid int, region *config.Region) string {
+	return filepath.Join(region.GameDir, fmt.Sprintf("game%06d.zst", sid))
+}
+
+// the client isn't consistent about padding so accept both
+func decodeBase64(s string) (string, error) {
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return "", err
+	}
+
+	return string(decoded), nil
+}
+
+// generates the password used to look up a game with /api/rpglistpassword
+func newPassword() (string, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	for i, b := range buf {
+		buf[i] = passwordChars[int(b)%len(passwordChars)]
+	}
+
+	return string(buf), nil
+}
+
+// flags are sent as "0" or "1"
+func flag(b bool) string {
+	if b {
+		return "1"
+	}
+
+	return "0"
+}
@@ -0,0 +1,268 @@
+/*
+	reFES - A RPG Maker FES server emulator
+	Copyright (C) 2023  maru <maru@myyahoo.com>
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type Config struct {
+	Listen   Listen   `json:"listen"`
+	Database Database `json:"database"`
+	Admin    Admin    `json:"admin"`
+	Blobs    Blobs    `json:"blobs"`
+
+	Regions []Region `json:"regions"`
+
+	NgWords string `json:"ngwords"` // path to the user name filter list
+
+	Famer Famer `json:"famer"`
+
+	Maintenance          bool `json:"maintenance"`
+	ContestMode          bool `json:"contestmode"`          // forces contest mode on even when no contest is accepting entries
+	ContestAwards        int  `json:"contestawards"`        // number of top ranked entries given an award
+	SearchOtherCountries bool `json:"searchothercountries"` // merge every public region's games into lists and searches
+}
+
+type Region struct {
+	Id       int      `json:"id"`       // 1-20, identifies games from this region to clients in other regions
+	Codes    []string `json:"codes"`    // client region codes that belong to this region, "" matches clients that don't send one
+	Tables   string   `json:"tables"`   // table suffix, ie "jp" for games_jp
+	GameDir  string   `json:"gamedir"`  // directory games uploaded before the blob store are read from, optional
+	Lang     string   `json:"lang"`     // used when the client doesn't send one
+	Timezone string   `json:"timezone"` // IANA name dates are shown to clients in, empty shows them as stored, in UTC
+	Default  bool     `json:"default"`  // used for codes no region claims
+
+	// private regions are only usable by the listed console tokens, good for testing
+	Private bool     `json:"private"`
+	Tokens  []string `json:"tokens"`
+}
+
+// games meeting any rule are inducted into the hall of fame automatically, zero disables a rule
+type Famer struct {
+	DlCount       int     `json:"dlcount"`       // downloaded at least this many times
+	ReviewAve     float64 `json:"reviewave"`     // reviewed at least this well...
+	ReviewDlCount int     `json:"reviewdlcount"` // ...once downloaded this many times
+	Award         int     `json:"award"`         // won a contest award below this, 1 for grand prize winners only
+}
+
+type Listen struct {
+	Proto   string `json:"proto"` // "tcp", "unix", etc
+	Address string `json:"address"`
+}
+
+// the admin api and moderation dashboard are only started when an address is set
+type Admin struct {
+	Listen
+	Token string `json:"token"` // required as a bearer token or basic auth password
+}
+
+// where game data is kept, shared by every region
+type Blobs struct {
+	Driver string   `json:"driver"` // "fs" or "s3"
+	Roots  []string `json:"roots"`  // fs directories, new games are written to the first and looked for in all of them
+	S3     S3       `json:"s3"`
+
+	Level int      `json:"level"` // zstd level new games are compressed at, 0 for the default
+	Dicts []string `json:"dicts"` // zstd dictionary files, the first compresses new games and the rest still decompress old ones
+
+	CacheSize int `json:"cachesize"` // megabytes of decompressed games kept in memory for downloads, 0 disables
+}
+
+// any s3 compatible service, buckets are addressed by path
+type S3 struct {
+	Endpoint  string `json:"endpoint"` // ie "https://s3.us-east-1.amazonaws.com" or "http://127.0.0.1:9000"
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"` // prepended to every key
+	AccessKey string `json:"accesskey"`
+	SecretKey string `json:"secretkey"`
+}
+
+type Database struct {
+	Driver  string `json:"driver"` // "mysql", "sqlite", or "memory" for tests, nothing is kept across restarts
+	User    string `json:"user"`
+	Pass    string `json:"pass"`
+	Proto   string `json:"proto"`
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	Path    string `json:"path"` // sqlite database file
+}
+
+func (d Database) DSN() string {
+	// clientFoundRows so updates that don't change anything still count the rows they matched
+	return fmt.Sprintf("%s:%s@%s(%s)/%s?parseTime=true&clientFoundRows=true", d.User, d.Pass, d.Proto, d.Address, d.Name)
+}
+
+// matches how the server behaved before it was configurable, except that clients are no longer
+// told they can search other countries, which the server never actually did
+func Default() *Config {
+	return &Config{
+		Listen: Listen{
+			Proto:   "tcp",
+			Address: "0.0.0.0:8100",
+		},
+		Admin: Admin{
+			Listen: Listen{
+				Proto: "tcp",
+			},
+		},
+		Blobs: Blobs{
+			Driver:    "fs",
+			Roots:     []string{"games"},
+			CacheSize: 64,
+			S3: S3{
+				Region: "us-east-1",
+			},
+		},
+		Database: Database{
+			Driver:  "mysql",
+			Proto:   "tcp",
+			Address: "127.0.0.1:3306",
+			Name:    "refes",
+			Path:    "refes.db",
+		},
+		Regions: []Region{
+			{
+				Id:      1,
+				Codes:   []string{"", "JPN"},
+				Tables:  "jp",
+				GameDir: "games_jp",
+				Lang:    "ja",
+			},
+			{
+				Id:      2,
+				Codes:   []string{"USA"},
+				Tables:  "us",
+				GameDir: "games_us",
+				Lang:    "en",
+				Default: true,
+			},
+		},
+		NgWords:       "ngwords.txt",
+		ContestAwards: 3,
+	}
+}
+
+// reads the config file at path over the defaults, then applies environment overrides
+// a missing file isn't an error so the server can be configured with the environment alone
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	file, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		defaultRegions := config.Regions
+		config.Regions = nil // replace rather than merge with the defaults
+
+		err = json.Unmarshal(file, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+
+		if len(config.Regions) == 0 {
+			config.Regions = defaultRegions
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	err = config.loadEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (c *Config) loadEnv() error {
+	strs := map[string]*string{
+		"REFES_LISTEN_PROTO":  &c.Listen.Proto,
+		"REFES_LISTEN_ADDR":   &c.Listen.Address,
+		"REFES_ADMIN_PROTO":   &c.Admin.Proto,
+		"REFES_ADMIN_ADDR":    &c.Admin.Address,
+		"REFES_ADMIN_TOKEN":   &c.Admin.Token,
+		"REFES_DB_DRIVER":     &c.Database.Driver,
+		"REFES_DB_USER":       &c.Database.User,
+		"REFES_DB_PASS":       &c.Database.Pass,
+		"REFES_DB_PROTO":      &c.Database.Proto,
+		"REFES_DB_ADDR":       &c.Database.Address,
+		"REFES_DB_NAME":       &c.Database.Name,
+		"REFES_DB_PATH":       &c.Database.Path,
+		"REFES_NGWORDS":       &c.NgWords,
+		"REFES_BLOB_DRIVER":   &c.Blobs.Driver,
+		"REFES_S3_ENDPOINT":   &c.Blobs.S3.Endpoint,
+		"REFES_S3_REGION":     &c.Blobs.S3.Region,
+		"REFES_S3_BUCKET":     &c.Blobs.S3.Bucket,
+		"REFES_S3_PREFIX":     &c.Blobs.S3.Prefix,
+		"REFES_S3_ACCESS_KEY": &c.Blobs.S3.AccessKey,
+		"REFES_S3_SECRET_KEY": &c.Blobs.S3.SecretKey,
+	}
+	for name, value := range strs {
+		if env, ok := os.LookupEnv(name); ok {
+			*value = env
+		}
+	}
+
+	// lists are separated like PATH
+	if env, ok := os.LookupEnv("REFES_BLOB_ROOTS"); ok {
+		c.Blobs.Roots = filepath.SplitList(env)
+	}
+	if env, ok := os.LookupEnv("REFES_BLOB_DICTS"); ok {
+		c.Blobs.Dicts = filepath.SplitList(env)
+	}
+
+	ints := map[string]*int{
+		"REFES_BLOB_LEVEL":      &c.Blobs.Level,
+		"REFES_BLOB_CACHE_SIZE": &c.Blobs.CacheSize,
+	}
+	for name, value := range ints {
+		if env, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.Atoi(env)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+
+			*value = parsed
+		}
+	}
+
+	bools := map[string]*bool{
+		"REFES_MAINTENANCE":            &c.Maintenance,
+		"REFES_CONTEST_MODE":           &c.ContestMode,
+		"REFES_SEARCH_OTHER_COUNTRIES": &c.SearchOtherCountries,
+	}
+	for name, value := range bools {
+		if env, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseBool(env)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+
+			*value = parsed
+		}
+	}
+
+	return nil
+}
@@ -22,14 +22,39 @@ import (
 	"flag"
 	"log"
 	"refes/api"
+	"refes/config"
 )
 
 func main() {
-	proto := flag.String("proto", "tcp", "protocol to use (\"tcp\", \"unix\", etc)")
-	addr := flag.String("addr", "0.0.0.0:8100", "address to listen on")
+	path := flag.String("config", "config.json", "path to the config file")
+	proto := flag.String("proto", "", "protocol to use (\"tcp\", \"unix\", etc), overrides the config")
+	addr := flag.String("addr", "", "address to listen on, overrides the config")
 	flag.Parse()
 
-	err := api.Init(proto, addr)
+	conf, err := config.Load(*path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *proto != "" {
+		conf.Listen.Proto = *proto
+	}
+
+	if *addr != "" {
+		conf.Listen.Address = *addr
+	}
+
+	// refes migrate up/down/status
+	if flag.Arg(0) == "migrate" {
+		err = api.Migrate(conf, flag.Arg(1))
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		return
+	}
+
+	err = api.Init(conf)
 	if err != nil {
 		log.Fatalln(err)
 	}